@@ -1,5 +1,9 @@
 // Package gzenv implements a compressed environment format using json+gzip+base64.
 // It provides a quickly designed format to export the whole environment back into itself.
+//
+// The current version is prefixed with its version and a checksum of the
+// compressed data: "v2:CRC32:BASE64". Strings without prefix are read as the
+// original format, so environments exported by older versions keep working.
 package gzenv
 
 import (
@@ -7,12 +11,24 @@ import (
 	"compress/zlib"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"hash/crc32"
 	"io"
+	"log"
 	"strings"
 )
 
+// prefix marks the version 2 of the format
+const prefix = "v2:"
+
+// MaxSize is the maximum size of the decompressed data, to protect against
+// decompression bombs.
+const MaxSize = 64 << 20
+
+// ErrTooLarge is returned when the decompressed data is larger than MaxSize.
+var ErrTooLarge = fmt.Errorf("unmarshal() decompressed data larger than %d bytes", MaxSize)
+
 // Marshal encodes the object into the gzenv format
 func Marshal(obj interface{}) string {
 	jsonData, err := json.Marshal(obj)
@@ -31,18 +47,31 @@ func Marshal(obj interface{}) string {
 
 	base64Data := base64.URLEncoding.EncodeToString(zlibData.Bytes())
 
-	return base64Data
+	return prefix + checksum(zlibData.Bytes()) + ":" + base64Data
 }
 
 // Unmarshal restores the gzenv format back into a Go object
 func Unmarshal(gzenv string, obj interface{}) error {
 	gzenv = strings.TrimSpace(gzenv)
 
+	var sum string
+	if rest, ok := strings.CutPrefix(gzenv, prefix); ok {
+		if sum, gzenv, ok = strings.Cut(rest, ":"); !ok || sum == "" {
+			return errors.New("unmarshal() missing checksum")
+		}
+	} else if version, _, ok := strings.Cut(gzenv, ":"); ok {
+		return fmt.Errorf("unmarshal() unsupported version %q", version)
+	}
+
 	data, err := base64.URLEncoding.DecodeString(gzenv)
 	if err != nil {
 		return fmt.Errorf("unmarshal() base64 decoding: %w", err)
 	}
 
+	if sum != "" && sum != checksum(data) {
+		return errors.New("unmarshal() checksum mismatch, the data is corrupted")
+	}
+
 	zlibReader := bytes.NewReader(data)
 	w, err := zlib.NewReader(zlibReader)
 	if err != nil {
@@ -50,12 +79,14 @@ func Unmarshal(gzenv string, obj interface{}) error {
 	}
 
 	envData := bytes.NewBuffer([]byte{})
-	// G110: Potential DoS vulnerability via decompression bomb (gosec)
-	// #nosec
-	_, err = io.Copy(envData, w)
+	// Read one byte more than allowed to detect larger data
+	_, err = io.Copy(envData, io.LimitReader(w, MaxSize+1))
 	if err != nil {
 		return fmt.Errorf("unmarshal() zlib decoding: %w", err)
 	}
+	if envData.Len() > MaxSize {
+		return ErrTooLarge
+	}
 	if err := w.Close(); err != nil {
 		log.Printf("Warning: failed to close zlib reader: %v", err)
 	}
@@ -67,3 +98,8 @@ func Unmarshal(gzenv string, obj interface{}) error {
 
 	return nil
 }
+
+// checksum returns the hex CRC-32 of the compressed data.
+func checksum(data []byte) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))
+}
@@ -0,0 +1,70 @@
+package gzenv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	env := map[string]string{"FOO": "bar", "EMPTY": ""}
+
+	s := Marshal(env)
+	if !strings.HasPrefix(s, prefix) {
+		t.Fatalf("expected %q to start with %q", s, prefix)
+	}
+
+	var out map[string]string
+	if err := Unmarshal(s, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, env) {
+		t.Errorf("expected %v, got %v", env, out)
+	}
+}
+
+func TestUnmarshalV1(t *testing.T) {
+	// As exported by the previous versions
+	var out map[string]string
+	if err := Unmarshal("eJyrVnLz91eyUkpKLFKqBQAZugPU", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["FOO"] != "bar" {
+		t.Errorf("unexpected %v", out)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	s := Marshal(map[string]string{"FOO": "bar"})
+	var out map[string]string
+
+	if err := Unmarshal(s[:len(s)-4], &out); err == nil {
+		t.Error("expected truncated data to be rejected")
+	}
+	if err := Unmarshal(prefix+"00000000"+s[len(prefix)+8:], &out); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if err := Unmarshal(prefix+":"+s[len(prefix)+9:], &out); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected an empty checksum to be rejected, got %v", err)
+	}
+	if err := Unmarshal("v3:"+s[len(prefix):], &out); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("expected an unsupported version, got %v", err)
+	}
+}
+
+func TestUnmarshalTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(bytes.Repeat([]byte(" "), MaxSize+1))
+	_ = w.Close()
+
+	var out map[string]string
+	err := Unmarshal(base64.URLEncoding.EncodeToString(buf.Bytes()), &out)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+// AllowRecord is the content of an allow file. It records which RC file has
+// been approved, by whom and for how long.
+//
+// Older versions of direnv only wrote the path of the RC file followed by a
+// newline. Those records are still understood and never expire.
+type AllowRecord struct {
+	Path      string     `json:"path"`
+	AllowedBy string     `json:"allowed_by,omitempty"`
+	AllowedAt time.Time  `json:"allowed_at,omitzero"`
+	Version   string     `json:"version,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AllowOptions are the user-provided settings for a new allow record.
+type AllowOptions struct {
+	// Duration is how long the approval is valid for. Zero means forever.
+	Duration time.Duration
+	// Reason is an optional free-form note stored alongside the approval.
+	Reason string
+}
+
+// NewAllowRecord creates a record for the RC file at path, approved now by
+// the current user.
+func NewAllowRecord(path string, opts AllowOptions) *AllowRecord {
+	now := time.Now().UTC().Truncate(time.Second)
+	record := &AllowRecord{
+		Path:      path,
+		AllowedBy: currentUserName(),
+		AllowedAt: now,
+		Version:   version,
+		Reason:    opts.Reason,
+	}
+	if opts.Duration > 0 {
+		expiresAt := now.Add(opts.Duration)
+		record.ExpiresAt = &expiresAt
+	}
+	return record
+}
+
+// ReadAllowRecord loads the allow record stored at allowPath.
+func ReadAllowRecord(allowPath string) (*AllowRecord, error) {
+	data, err := os.ReadFile(allowPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAllowRecord(data)
+}
+
+// ParseAllowRecord decodes the content of an allow file. Legacy records that
+// only contain the RC path are returned without any metadata.
+func ParseAllowRecord(data []byte) (*AllowRecord, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return &AllowRecord{Path: string(data)}, nil
+	}
+
+	record := new(AllowRecord)
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("invalid allow record: %w", err)
+	}
+	return record, nil
+}
+
+// Write stores the record at allowPath.
+func (record *AllowRecord) Write(allowPath string) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// G306: Expect WriteFile permissions to be 0600 or less
+	// #nosec
+	return os.WriteFile(allowPath, append(data, '\n'), 0644)
+}
+
+// Expired returns true if the record had an expiry and it has passed.
+func (record *AllowRecord) Expired(now time.Time) bool {
+	return record.ExpiresAt != nil && !now.Before(*record.ExpiresAt)
+}
+
+func currentUserName() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAllowRecordLegacy(t *testing.T) {
+	record, err := ParseAllowRecord([]byte("/foo/.envrc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Path != "/foo/.envrc" {
+		t.Errorf("unexpected path %q", record.Path)
+	}
+	if record.Expired(time.Now()) {
+		t.Error("legacy records should never expire")
+	}
+}
+
+func TestAllowRecordExpiry(t *testing.T) {
+	record := NewAllowRecord("/foo/.envrc", AllowOptions{Duration: time.Hour, Reason: "review"})
+	if record.Expired(time.Now()) {
+		t.Error("record should not be expired yet")
+	}
+	if !record.Expired(time.Now().Add(2 * time.Hour)) {
+		t.Error("record should be expired")
+	}
+
+	allowPath := t.TempDir() + "/allow"
+	if err := record.Write(allowPath); err != nil {
+		t.Fatal(err)
+	}
+	record2, err := ReadAllowRecord(allowPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record2.Path != record.Path || record2.Reason != "review" || !record2.ExpiresAt.Equal(*record.ExpiresAt) {
+		t.Errorf("round-trip mismatch: %#v != %#v", record2, record)
+	}
+}
+
+func TestExportUnloadsExpiredApproval(t *testing.T) {
+	rcPath := filepath.Join(t.TempDir(), ".envrc.toml")
+	if err := os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}, WorkDir: filepath.Dir(rcPath)}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.AllowWith(AllowOptions{Duration: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	currentEnv, err := rc.Load(Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The approval lapses without touching the watched files
+	stat, err := os.Stat(rc.allowPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := rc.AllowRecord()
+	expiresAt := time.Now().Add(-time.Minute)
+	record.ExpiresAt = &expiresAt
+	if err = record.Write(rc.allowPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(rc.allowPath, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Env = currentEnv
+	out, err := captureExport(t, currentEnv, config)
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected the approval to be reported as expired, got %v", err)
+	}
+	if !strings.Contains(out, "unset FOO") {
+		t.Errorf("expected FOO to be unset, got %q", out)
+	}
+
+	// Once blocked, there is nothing left to reload
+	blockedEnv, err := rc.Load(Env{})
+	if err == nil {
+		t.Fatal("expected the RC to be blocked")
+	}
+	config.Env = blockedEnv
+	if approvalLapsed(config, rc) {
+		t.Error("expected the blocked environment not to be reloaded")
+	}
+}
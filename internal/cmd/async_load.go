@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PendingLoad is an evaluation of an RC file running in the background.
+type PendingLoad struct {
+	Path    string    `json:"path"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// asyncResult is what the background worker leaves behind for the next
+// `direnv export`.
+type asyncResult struct {
+	Env   Env    `json:"env"`
+	Error string `json:"error,omitempty"`
+}
+
+// AsyncLoadDir is the folder where the background evaluations keep their
+// state and results.
+func (config *Config) AsyncLoadDir() string {
+	return filepath.Join(config.CacheDir, "async")
+}
+
+// asyncLoadPath returns where the given file of the evaluation identified by
+// key is stored. ext is one of ".pending", ".log" or ".json".
+func (config *Config) asyncLoadPath(key, ext string) string {
+	return filepath.Join(config.AsyncLoadDir(), key+ext)
+}
+
+// AsyncEnvFromRC is like EnvFromRC, but runs the evaluation in a detached
+// worker. pending is true as long as the worker hasn't finished, in which
+// case the environment must be left alone.
+func (config *Config) AsyncEnvFromRC(path string, previousEnv Env) (newEnv Env, pending bool, err error) {
+	rc, err := RCFromPath(path, config)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Blocked files and cached environments don't need a worker
+	if rc.Allowed() != Allowed || (config.CacheEnv && rc.loadCachedEnv(previousEnv) != nil) {
+		newEnv, err = rc.Load(previousEnv)
+		return newEnv, false, err
+	}
+
+	key := rc.envCacheKey(previousEnv)
+	if result := config.takeAsyncResult(key); result != nil {
+		if result.Env == nil {
+			// Without an environment to record the watches, the worker would be
+			// spawned again on each prompt
+			logError(config, "failed to load in the background, loading now: %s", result.Error)
+			newEnv, err = rc.Load(previousEnv)
+			return newEnv, false, err
+		}
+		if result.Error != "" {
+			err = errors.New(result.Error)
+		}
+		return result.Env, false, err
+	}
+
+	if load := config.readPendingLoad(key); load != nil && processAlive(load.PID) {
+		return nil, true, nil
+	}
+
+	if err = config.startAsyncLoad(rc, key, previousEnv); err != nil {
+		logError(config, "failed to load in the background, loading now: %v", err)
+		newEnv, err = rc.Load(previousEnv)
+		return newEnv, false, err
+	}
+	logStatus(config, "loading %s in the background", userRelPath(config.Env, rc.path))
+	return nil, true, nil
+}
+
+// startAsyncLoad spawns `direnv async-load` detached from the terminal.
+func (config *Config) startAsyncLoad(rc *RC, key string, previousEnv Env) (err error) {
+	if err = os.MkdirAll(config.AsyncLoadDir(), 0700); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(config.asyncLoadPath(key, ".log"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = logFile.Close() }()
+
+	cmd := exec.Command(config.SelfPath, "async-load", key, rc.path)
+	cmd.Dir = config.WorkDir
+	cmd.Env = previousEnv.ToGoEnv()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detachProcess(cmd)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(PendingLoad{rc.path, cmd.Process.Pid, time.Now()})
+	if err != nil {
+		return err
+	}
+	// The worker is not waited for, it outlives this process
+	_ = cmd.Process.Release()
+	return os.WriteFile(config.asyncLoadPath(key, ".pending"), data, 0600)
+}
+
+// readPendingLoad returns the state of the worker for key, or nil.
+func (config *Config) readPendingLoad(key string) *PendingLoad {
+	data, err := os.ReadFile(config.asyncLoadPath(key, ".pending"))
+	if err != nil {
+		return nil
+	}
+	load := new(PendingLoad)
+	if err = json.Unmarshal(data, load); err != nil {
+		logDebug("async load: %s: %v", key, err)
+		return nil
+	}
+	return load
+}
+
+// takeAsyncResult returns the result of the worker for key and forwards its
+// output, or nil if there is none. Results outdated by changes to the watched
+// files are dropped.
+func (config *Config) takeAsyncResult(key string) *asyncResult {
+	resultPath := config.asyncLoadPath(key, ".json")
+	data, err := os.ReadFile(resultPath)
+	if err != nil {
+		return nil
+	}
+	logPath := config.asyncLoadPath(key, ".log")
+	output, _ := os.ReadFile(logPath)
+	_ = os.Remove(resultPath)
+	_ = os.Remove(logPath)
+
+	result := new(asyncResult)
+	if err = json.Unmarshal(data, result); err != nil {
+		logDebug("async load: %s: %v", key, err)
+		return nil
+	}
+	if result.Env != nil {
+		times := NewFileTimes()
+		_, watches := result.Env.loadedState()
+		if err = times.Unmarshal(watches); err != nil || times.Check() != nil {
+			logDebug("async load: %s: outdated result", key)
+			return nil
+		}
+	}
+
+	_, _ = os.Stderr.Write(output)
+	return result
+}
+
+// PendingLoads lists the evaluations still running in the background.
+func (config *Config) PendingLoads() ([]PendingLoad, error) {
+	names, err := readDirNames(config.AsyncLoadDir())
+	if err != nil {
+		return nil, err
+	}
+	var loads []PendingLoad
+	for _, name := range names {
+		key, ok := strings.CutSuffix(name, ".pending")
+		if !ok {
+			continue
+		}
+		if load := config.readPendingLoad(key); load != nil && processAlive(load.PID) {
+			loads = append(loads, *load)
+		}
+	}
+	sort.Slice(loads, func(i, j int) bool {
+		return loads[i].Started.Before(loads[j].Started)
+	})
+	return loads, nil
+}
+
+// pruneAsyncLoads removes the state of the workers that died and the results
+// that were never picked up.
+func pruneAsyncLoads(config *Config) error {
+	asyncDir := config.AsyncLoadDir()
+	names, err := readDirNames(asyncDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		key := strings.TrimSuffix(name, filepath.Ext(name))
+		if load := config.readPendingLoad(key); load == nil || !processAlive(load.PID) {
+			_ = os.Remove(filepath.Join(asyncDir, name))
+		}
+	}
+	return nil
+}
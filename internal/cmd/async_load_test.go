@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncLoadResult(t *testing.T) {
+	config := &Config{CacheDir: t.TempDir()}
+	if err := os.MkdirAll(config.AsyncLoadDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	rcPath := filepath.Join(t.TempDir(), ".envrc")
+	if err := os.WriteFile(rcPath, []byte("export FOO=bar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	times := NewFileTimes()
+	if err := times.Update(rcPath); err != nil {
+		t.Fatal(err)
+	}
+
+	writeResult := func(key string, env Env) {
+		data, err := json.Marshal(asyncResult{Env: env})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(config.asyncLoadPath(key, ".json"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeResult("current", Env{"FOO": "bar", DIRENV_WATCHES: times.Marshal()})
+	result := config.takeAsyncResult("current")
+	if result == nil || result.Env["FOO"] != "bar" {
+		t.Fatalf("expected the result to be returned, got %v", result)
+	}
+	if config.takeAsyncResult("current") != nil {
+		t.Error("expected the result to be consumed")
+	}
+
+	writeResult("outdated", Env{"FOO": "bar", DIRENV_WATCHES: times.Marshal()})
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(rcPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if config.takeAsyncResult("outdated") != nil {
+		t.Error("expected the outdated result to be dropped")
+	}
+}
+
+func TestPendingLoads(t *testing.T) {
+	config := &Config{CacheDir: t.TempDir()}
+	if err := os.MkdirAll(config.AsyncLoadDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, load := range map[string]PendingLoad{
+		"alive": {"/alive/.envrc", os.Getpid(), time.Now()},
+		"dead":  {"/dead/.envrc", -1, time.Now()},
+	} {
+		data, _ := json.Marshal(load)
+		if err := os.WriteFile(config.asyncLoadPath(key, ".pending"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loads, err := config.PendingLoads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loads) != 1 || loads[0].Path != "/alive/.envrc" {
+		t.Errorf("expected only the alive load, got %v", loads)
+	}
+}
+
+func TestAsyncLoadFailedResult(t *testing.T) {
+	rcPath := filepath.Join(t.TempDir(), ".envrc.toml")
+	if err := os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{CacheDir: t.TempDir(), DataDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(config.AsyncLoadDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker that failed before evaluating leaves no environment
+	previousEnv := Env{}
+	data, _ := json.Marshal(asyncResult{Error: "failed"})
+	if err = os.WriteFile(config.asyncLoadPath(rc.envCacheKey(previousEnv), ".json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newEnv, pending, err := config.AsyncEnvFromRC(rcPath, previousEnv)
+	if err != nil || pending {
+		t.Fatalf("expected a synchronous load, got pending=%v err=%v", pending, err)
+	}
+	if newEnv["FOO"] != "bar" || newEnv[DIRENV_WATCHES] == "" {
+		t.Errorf("expected the loaded environment with its watches, got %v", newEnv)
+	}
+}
+
+func TestExportUnloadsWhilePending(t *testing.T) {
+	config := &Config{CacheDir: t.TempDir(), DataDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}, AsyncLoad: true}
+	var rcs []*RC
+	for _, content := range []string{"[env]\nFOO = \"a\"\n", "[env]\nBAR = \"b\"\n"} {
+		rcPath := filepath.Join(t.TempDir(), ".envrc.toml")
+		if err := os.WriteFile(rcPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		rc, err := RCFromPath(rcPath, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = rc.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		rcs = append(rcs, rc)
+	}
+	currentEnv, err := rcs[0].Load(Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second project is being loaded in the background
+	config.Env = currentEnv
+	config.WorkDir = filepath.Dir(rcs[1].path)
+	previousEnv, err := config.Revert(currentEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(config.AsyncLoadDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(PendingLoad{rcs[1].path, os.Getpid(), time.Now()})
+	if err = os.WriteFile(config.asyncLoadPath(rcs[1].envCacheKey(previousEnv), ".pending"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureExport(t, currentEnv, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first project is unloaded, the markers stay to pick up the result
+	if !strings.Contains(out, "unset FOO") {
+		t.Errorf("expected FOO to be unset, got %q", out)
+	}
+	if strings.Contains(out, "BAR") || strings.Contains(out, DIRENV_DIFF) {
+		t.Errorf("expected only the unload, got %q", out)
+	}
+}
+
+// captureExport runs `direnv export bash` and returns what it printed.
+func captureExport(t *testing.T, currentEnv Env, config *Config) (string, error) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	err = exportCommand(currentEnv, []string{"export", "bash"}, config)
+	os.Stdout = stdout
+	_ = w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out), err
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Audit event names
+const (
+	AuditAllow  = "allow"
+	AuditDeny   = "deny"
+	AuditLoad   = "load"
+	AuditUnload = "unload"
+)
+
+// Audit outcomes
+const (
+	AuditAllowed  = "allowed"
+	AuditBlocked  = "blocked"
+	AuditDenied   = "denied"
+	AuditError    = "error"
+	AuditUnloaded = "unloaded"
+)
+
+// AuditEvent is a single line of the audit log.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Event   string    `json:"event"`
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash,omitempty"`
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+	Changed []string  `json:"changed,omitempty"`
+}
+
+// AuditLogPath is the file where the audit events are appended.
+func (config *Config) AuditLogPath() string {
+	return filepath.Join(config.DataDir, "audit.log")
+}
+
+// audit appends an event about the RC file at rcPath to the audit log, if
+// enabled. Failing to write the audit log is not fatal.
+func (config *Config) audit(event, rcPath, outcome string, err error, diff *EnvDiff) {
+	if !config.AuditLog {
+		return
+	}
+
+	e := AuditEvent{
+		Time:    time.Now().UTC(),
+		User:    currentUserName(),
+		Event:   event,
+		Path:    rcPath,
+		Outcome: outcome,
+	}
+	e.Host, _ = os.Hostname()
+	if sum, hashErr := contentHash(rcPath); hashErr == nil {
+		e.Hash = sum
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if diff != nil {
+		e.Changed = diffKeys(diff)
+	}
+
+	if writeErr := appendAuditEvent(config.AuditLogPath(), &e); writeErr != nil {
+		logError(config, "failed to write the audit log: %v", writeErr)
+	}
+}
+
+func appendAuditEvent(auditPath string, e *AuditEvent) (err error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(auditPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ReadAuditLog calls fn for each event of the audit log, in order.
+func ReadAuditLog(auditPath string, fn func(e *AuditEvent) error) error {
+	f, err := os.Open(auditPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := bufio.NewReader(f)
+	for i := 1; ; i++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			e := new(AuditEvent)
+			if jsonErr := json.Unmarshal(line, e); jsonErr != nil {
+				logDebug("audit log line %d: %v", i, jsonErr)
+			} else if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// diffKeys returns the sorted names of the non-direnv variables changed by
+// the diff.
+func diffKeys(diff *EnvDiff) []string {
+	var keys []string
+	for key := range diff.Prev {
+		if !direnvKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range diff.Next {
+		if _, ok := diff.Prev[key]; !ok && !direnvKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
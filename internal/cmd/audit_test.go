@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), AuditLog: true}
+	rcPath := filepath.Join(t.TempDir(), ".envrc")
+
+	diff := &EnvDiff{Prev: map[string]string{"OLD": "1", "PATH": "a"}, Next: map[string]string{"PATH": "b", "NEW": "2", DIRENV_DIR: "-/x"}}
+	config.audit(AuditLoad, rcPath, AuditAllowed, nil, diff)
+	config.audit(AuditLoad, rcPath, AuditError, errors.New("boom"), nil)
+
+	var events []*AuditEvent
+	err := ReadAuditLog(config.AuditLogPath(), func(e *AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0].Changed, []string{"NEW", "OLD", "PATH"}) {
+		t.Errorf("unexpected changed keys %v", events[0].Changed)
+	}
+	if events[1].Outcome != AuditError || events[1].Error != "boom" {
+		t.Errorf("unexpected event %#v", events[1])
+	}
+
+	filter := auditFilter{outcome: AuditError}
+	if filter.match(events[0]) || !filter.match(events[1]) {
+		t.Error("outcome filter mismatch")
+	}
+}
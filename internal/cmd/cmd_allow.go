@@ -2,19 +2,22 @@
 package cmd
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // CmdAllow is `direnv allow [PATH_TO_RC]`
 var CmdAllow = &Cmd{
 	Name:    "allow",
 	Desc:    "Grants direnv permission to load the given .envrc or .env file.",
-	Args:    []string{"[PATH_TO_RC]"},
+	Args:    []string{"[--review]", "[--for DURATION]", "[--reason REASON]", "[PATH_TO_RC]"},
 	Aliases: []string{"permit", "grant"},
 	Action:  actionWithConfig(cmdAllowAction),
 }
@@ -29,6 +32,10 @@ being moved to XDG_DATA_HOME.
 
 func cmdAllowAction(env Env, args []string, config *Config) (err error) {
 	var rcPath string
+	var flags allowFlags
+	if args, flags, err = parseAllowArgs(args); err != nil {
+		return err
+	}
 	if len(args) > 1 {
 		if rcPath, err = filepath.Abs(args[1]); err != nil {
 			return err
@@ -69,13 +76,19 @@ func cmdAllowAction(env Env, args []string, config *Config) (err error) {
 	if err != nil {
 		return err
 	} else if rc == nil {
-		if config.LoadDotenv {
-			return fmt.Errorf(".envrc or .env file not found")
+		return config.rcNotFound()
+	}
+
+	if flags.review {
+		var confirmed bool
+		if confirmed, err = reviewRC(rc); err != nil {
+			return err
+		} else if !confirmed {
+			return fmt.Errorf("%s was not allowed", rc.Path())
 		}
-		return fmt.Errorf(".envrc file not found")
 	}
 
-	if err = rc.Allow(); err != nil {
+	if err = rc.AllowWith(flags.AllowOptions); err != nil {
 		return err
 	}
 
@@ -89,9 +102,93 @@ func cmdAllowAction(env Env, args []string, config *Config) (err error) {
 	return nil
 }
 
+type allowFlags struct {
+	AllowOptions
+	review bool
+}
+
+// parseAllowArgs extracts the `--review`, `--for` and `--reason` flags from
+// args and returns the remaining positional arguments.
+func parseAllowArgs(args []string) (rest []string, flags allowFlags, err error) {
+	rest = args[:1]
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch name {
+		case "--review":
+			flags.review = true
+		case "--for", "--reason":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, flags, fmt.Errorf("%s requires an argument", name)
+				}
+				i++
+				value = args[i]
+			}
+			if name == "--reason" {
+				flags.Reason = value
+				continue
+			}
+			if flags.Duration, err = time.ParseDuration(value); err != nil {
+				return nil, flags, fmt.Errorf("invalid duration for --for: %w", err)
+			}
+			if flags.Duration <= 0 {
+				return nil, flags, fmt.Errorf("--for requires a positive duration")
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, flags, nil
+}
+
+// reviewRC shows the changes made to the RC file and its layers since it was
+// last allowed and asks the user for confirmation.
+func reviewRC(rc *RC) (bool, error) {
+	allowed, err := rc.AllowedContent(rc.path)
+	if err != nil {
+		return false, err
+	}
+	diff, err := rc.ReviewDiff()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case allowed == nil:
+		fmt.Printf("%s has never been allowed, this is its full content:\n\n", rc.Path())
+	case diff == "":
+		fmt.Printf("%s has not changed since it was last allowed.\n", rc.Path())
+	default:
+		fmt.Printf("%s changed since it was last allowed:\n\n", rc.Path())
+	}
+	fmt.Print(diff)
+
+	fmt.Print("\nAllow this file? [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
 func allowRequiredFiles(rcPath, requiredPaths string, config *Config) error {
-	rcDir := filepath.Dir(rcPath)
+	paths := strings.Split(requiredPaths, ":")
+	for _, relPath := range paths {
+		if err := allowRequiredFile(rcPath, relPath, config); err != nil {
+			return err
+		}
 
+		fmt.Printf("direnv: allowing %s\n", relPath)
+	}
+
+	return nil
+}
+
+// allowRequiredFile records the current content of relPath, relative to the
+// RC file, as approved.
+func allowRequiredFile(rcPath, relPath string, config *Config) error {
 	envrcPathHash, err := pathHash(rcPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash envrc path: %w", err)
@@ -103,24 +200,19 @@ func allowRequiredFiles(rcPath, requiredPaths string, config *Config) error {
 		return fmt.Errorf("failed to create allowed-required directory: %w", err)
 	}
 
-	paths := strings.Split(requiredPaths, ":")
-	for _, relPath := range paths {
-		absPath := filepath.Join(rcDir, relPath)
-
-		hash, err := fileHash(absPath)
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				return fmt.Errorf("required file does not exist: %s", relPath)
-			}
-			return fmt.Errorf("failed to hash required file %s: %w", relPath, err)
-		}
+	absPath := filepath.Join(filepath.Dir(rcPath), relPath)
 
-		allowedRequiredFile := filepath.Join(allowedRequiredDir, hash)
-		if err := os.WriteFile(allowedRequiredFile, []byte(relPath+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to write allowed-required file entry: %w", err)
+	hash, err := fileHash(absPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("required file does not exist: %s", relPath)
 		}
+		return fmt.Errorf("failed to hash required file %s: %w", relPath, err)
+	}
 
-		fmt.Printf("direnv: allowing %s\n", relPath)
+	allowedRequiredFile := filepath.Join(allowedRequiredDir, hash)
+	if err := os.WriteFile(allowedRequiredFile, []byte(relPath+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write allowed-required file entry: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CmdAsyncLoad is `direnv async-load KEY PATH_TO_RC`
+var CmdAsyncLoad = &Cmd{
+	Name:    "async-load",
+	Desc:    "Evaluates an .envrc or .env in the background on behalf of `direnv export`",
+	Args:    []string{"KEY", "PATH_TO_RC"},
+	Private: true,
+	Action:  actionWithConfig(cmdAsyncLoadAction),
+}
+
+func cmdAsyncLoadAction(env Env, args []string, config *Config) error {
+	if len(args) < 3 {
+		return fmt.Errorf("not enough arguments")
+	}
+	key, rcPath := args[1], args[2]
+	defer func() { _ = os.Remove(config.asyncLoadPath(key, ".pending")) }()
+
+	var result asyncResult
+	rc, err := RCFromPath(rcPath, config)
+	if err == nil {
+		result.Env, err = rc.Load(env)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	resultPath := config.asyncLoadPath(key, ".json")
+	if err = os.WriteFile(resultPath+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(resultPath+".tmp", resultPath)
+}
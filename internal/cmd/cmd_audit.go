@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CmdAudit is `direnv audit`
+var CmdAudit = &Cmd{
+	Name: "audit",
+	Desc: `Queries the audit log of allow, deny, load and unload events. Requires
+  audit_log to be enabled in direnv.toml.`,
+	Args:   []string{"[--json]", "[--path PATH]", "[--hash SHA256]", "[--event EVENT]", "[--outcome OUTCOME]", "[--since DURATION|TIME]"},
+	Action: actionWithConfig(cmdAuditAction),
+}
+
+type auditFilter struct {
+	path    string
+	hash    string
+	event   string
+	outcome string
+	since   time.Time
+}
+
+func (f *auditFilter) match(e *AuditEvent) bool {
+	switch {
+	case f.path != "" && e.Path != f.path && !strings.HasPrefix(e.Path, f.path+string(filepath.Separator)):
+		return false
+	case f.hash != "" && !strings.HasPrefix(e.Hash, f.hash):
+		return false
+	case f.event != "" && e.Event != f.event:
+		return false
+	case f.outcome != "" && e.Outcome != f.outcome:
+		return false
+	case !f.since.IsZero() && e.Time.Before(f.since):
+		return false
+	}
+	return true
+}
+
+func cmdAuditAction(_ Env, args []string, config *Config) (err error) {
+	var filter auditFilter
+	var jsonOutput bool
+
+	for i := 1; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name == "-json" || name == "--json" {
+			jsonOutput = true
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires an argument", name)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "--path":
+			if filter.path, err = filepath.Abs(value); err != nil {
+				return err
+			}
+		case "--hash":
+			filter.hash = strings.ToLower(value)
+		case "--event":
+			filter.event = value
+		case "--outcome":
+			filter.outcome = value
+		case "--since":
+			if filter.since, err = parseSince(value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown argument %q", name)
+		}
+	}
+
+	if !config.AuditLog {
+		logError(config, "audit_log is not enabled in direnv.toml, no new events are being recorded")
+	}
+
+	err = ReadAuditLog(config.AuditLogPath(), func(e *AuditEvent) error {
+		if !filter.match(e) {
+			return nil
+		}
+		if jsonOutput {
+			line, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(line))
+			return nil
+		}
+
+		hash := e.Hash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		fmt.Printf("%s %s %s %-6s %-8s %s %s",
+			e.Time.Local().Format(time.RFC3339), e.Host, e.User, e.Event, e.Outcome, hash, e.Path)
+		if len(e.Changed) > 0 {
+			fmt.Printf(" [%s]", strings.Join(e.Changed, " "))
+		}
+		if e.Error != "" {
+			fmt.Printf(" (%s)", e.Error)
+		}
+		fmt.Println()
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// parseSince accepts either a duration relative to now or a RFC3339 time.
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid --since %q, expected a duration or a RFC3339 time", value)
+	}
+	return t, nil
+}
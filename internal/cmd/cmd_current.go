@@ -21,8 +21,8 @@ func cmdCurrentAction(env Env, args []string) (err error) {
 
 	path := args[1]
 	watches := NewFileTimes()
-	watchString, ok := env[DIRENV_WATCHES]
-	if ok {
+	_, watchString := env.loadedState()
+	if watchString != "" {
 		err = watches.Unmarshal(watchString)
 		if err != nil {
 			return
@@ -35,10 +35,7 @@ func cmdDenyAction(_ Env, args []string, config *Config) (err error) {
 	if err != nil {
 		return err
 	} else if rc == nil {
-		if config.LoadDotenv {
-			return fmt.Errorf(".envrc or .env file not found")
-		}
-		return fmt.Errorf(".envrc file not found")
+		return config.rcNotFound()
 	}
 
 	// Remove required files for this .envrc
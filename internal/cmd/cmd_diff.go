@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// CmdDiff is `direnv diff`
+var CmdDiff = &Cmd{
+	Name: "diff",
+	Desc: `Shows the variables changed by the loaded .envrc or .env, with their
+  previous and new values. The values of variables that look like secrets are
+  masked unless --show-secrets is given.`,
+	Args:   []string{"[--json]", "[--show-secrets]"},
+	Action: actionWithConfig(cmdDiffAction),
+}
+
+// secretKeyRe matches the names of the variables whose values are masked.
+var secretKeyRe = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|PASSPHRASE|CREDENTIAL|PRIVATE_KEY|API_KEY|ACCESS_KEY|(^|_)AUTH($|_))`)
+
+const (
+	maskedValue = "********"
+	addedColor  = "\033[32m"
+	changeColor = "\033[33m"
+)
+
+// diffEntry is a variable changed by the loaded RC, as shown by `direnv diff`.
+type diffEntry struct {
+	Key     string   `json:"key"`
+	Change  string   `json:"change"`
+	Old     *string  `json:"old,omitempty"`
+	New     *string  `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Masked  bool     `json:"masked,omitempty"`
+}
+
+// diffEntries returns the changes of the diff sorted by key, leaving out the
+// direnv internal variables.
+func diffEntries(diff *EnvDiff, showSecrets bool) []*diffEntry {
+	keys := make(map[string]bool)
+	for key := range diff.Prev {
+		keys[key] = true
+	}
+	for key := range diff.Next {
+		keys[key] = true
+	}
+
+	entries := make([]*diffEntry, 0, len(keys))
+	for key := range keys {
+		if direnvKey(key) {
+			continue
+		}
+		var prev, next *string
+		if value, ok := diff.Prev[key]; ok {
+			prev = &value
+		}
+		if value, ok := diff.Next[key]; ok {
+			next = &value
+		}
+		e := newDiffEntry(key, prev, next)
+		if list := diff.Lists[key]; list != nil {
+			e.Added = list.Added
+			e.Removed = list.Removed
+		}
+		if !showSecrets {
+			e.maskSecret()
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+func newDiffEntry(key string, prev, next *string) *diffEntry {
+	e := &diffEntry{Key: key, Old: prev, New: next}
+	switch {
+	case prev == nil:
+		e.Change = "added"
+	case next == nil:
+		e.Change = "removed"
+	default:
+		e.Change = "changed"
+	}
+	return e
+}
+
+// maskSecret hides the values if the variable looks like a secret.
+func (e *diffEntry) maskSecret() {
+	if !secretKeyRe.MatchString(e.Key) {
+		return
+	}
+	e.Masked = true
+	masked := maskedValue
+	if e.Old != nil {
+		e.Old = &masked
+	}
+	if e.New != nil {
+		e.New = &masked
+	}
+	e.Added = nil
+	e.Removed = nil
+}
+
+func cmdDiffAction(_ Env, args []string, config *Config) error {
+	var jsonOutput, showSecrets bool
+	for _, arg := range args[1:] {
+		switch arg {
+		case "-json", "--json":
+			jsonOutput = true
+		case "--show-secrets":
+			showSecrets = true
+		default:
+			return fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+
+	diff := NewEnvDiff()
+	if diffString, _ := config.Env.loadedState(); diffString != "" {
+		var err error
+		if diff, err = LoadEnvDiff(diffString); err != nil {
+			return err
+		}
+	}
+	entries := diffEntries(diff, showSecrets)
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	color := config.Env["NO_COLOR"] == "" && config.Env["TERM"] != "dumb" && isatty.IsTerminal(os.Stdout.Fd())
+	fmt.Print(formatDiffEntries(entries, color))
+	return nil
+}
+
+// formatDiffEntries renders the entries as text, one variable per line
+// followed by the elements added and removed for the list variables.
+func formatDiffEntries(entries []*diffEntry, color bool) string {
+	var b strings.Builder
+	line := func(c, format string, a ...interface{}) {
+		if color {
+			b.WriteString(c)
+		}
+		fmt.Fprintf(&b, format, a...)
+		if color {
+			b.WriteString(clearColor)
+		}
+		b.WriteByte('\n')
+	}
+	for _, e := range entries {
+		switch e.Change {
+		case "added":
+			line(addedColor, "+%s=%s", e.Key, *e.New)
+		case "removed":
+			line(errorColor, "-%s (was %s)", e.Key, *e.Old)
+		default:
+			if e.Added == nil && e.Removed == nil {
+				line(changeColor, "~%s: %s -> %s", e.Key, *e.Old, *e.New)
+				continue
+			}
+			line(changeColor, "~%s", e.Key)
+			for _, element := range e.Added {
+				line(addedColor, "    + %s", element)
+			}
+			for _, element := range e.Removed {
+				line(errorColor, "    - %s", element)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestDiffEntries(t *testing.T) {
+	before := Env{"PATH": "/usr/bin", "GONE": "x", "GITHUB_TOKEN": "old"}
+	loaded := Env{"PATH": "/proj/bin:/usr/bin", "FOO": "bar", "GITHUB_TOKEN": "new", "GIT_AUTHOR_NAME": "me", DIRENV_DIR: "-/proj"}
+	diff := BuildEnvDiff(before, loaded)
+
+	entries := diffEntries(diff, false)
+	out := formatDiffEntries(entries, false)
+	expected := `+FOO=bar
+~GITHUB_TOKEN: ******** -> ********
++GIT_AUTHOR_NAME=me
+-GONE (was x)
+~PATH
+    + /proj/bin
+`
+	if out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	for _, e := range diffEntries(diff, true) {
+		if e.Key == "GITHUB_TOKEN" && (e.Masked || *e.New != "new") {
+			t.Errorf("expected the secret to be shown, got %#v", e)
+		}
+	}
+}
@@ -38,11 +38,11 @@ func cmdEditAction(env Env, args []string, config *Config) (err error) {
 		rcPath = args[1]
 		fi, _ := os.Stat(rcPath)
 		if fi != nil && fi.IsDir() {
-			rcPath = filepath.Join(rcPath, ".envrc")
+			rcPath = filepath.Join(rcPath, config.RCNames[0])
 		}
 	} else {
 		if foundRC == nil {
-			return fmt.Errorf(".envrc or .env not found. Use `direnv edit .` to create a new .envrc in the current directory")
+			return fmt.Errorf("%s not found. Use `direnv edit .` to create a new %s in the current directory", strings.Join(config.RCNames, " or "), config.RCNames[0])
 		}
 		rcPath = foundRC.path
 	}
@@ -58,6 +58,9 @@ func cmdEditAction(env Env, args []string, config *Config) (err error) {
 	}
 
 	run := fmt.Sprintf("%s %s", editor, BashEscape(rcPath))
+	if config.BashPath == "" {
+		return errCantFindBash
+	}
 
 	// G204: Subprocess launched with function call as argument or cmd arguments
 	// #nosec
@@ -51,8 +51,11 @@ func cmdExecAction(env Env, args []string, config *Config) (err error) {
 	}
 	previousEnv.CleanContext()
 
+	// The environment isn't exported to a shell, no state to keep
+	config.PrivateState = false
+
 	// Load the rc
-	if toLoad := findEnvUp(rcPath, config.LoadDotenv); toLoad != "" {
+	if toLoad := findEnvUp(rcPath, config.RCNames); toLoad != "" {
 		if newEnv, err = config.EnvFromRC(toLoad, previousEnv); err != nil {
 			return
 		}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"time"
 )
 
 func supportedShellFormattedString() string {
@@ -45,7 +46,7 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 
 	logDebug("loading RCs")
 	loadedRC := config.LoadedRC()
-	toLoad := findEnvUp(config.WorkDir, config.LoadDotenv)
+	toLoad := findEnvUp(config.WorkDir, config.RCNames)
 
 	if loadedRC == nil && toLoad == "" {
 		return
@@ -67,6 +68,9 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		logDebug("new RC, loading")
 	case loadedRC.times.Check() != nil:
 		logDebug("file changed, reloading")
+	case approvalLapsed(config, loadedRC):
+		// Nothing changed on disk when an approval expires
+		logDebug("approval expired, reloading")
 	case currentEnv[DIRENV_REQUIRED] != "":
 		// Force reload if required files were pending approval.
 		// The approval status might have changed even if file times haven't.
@@ -84,12 +88,32 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		return
 	}
 
+	if err = mergeDrifted(config, currentEnv, previousEnv); err != nil {
+		logDebug("err: %v", err)
+		return
+	}
+
+	if loadedRC != nil && loadedRC.path != toLoad {
+		config.audit(AuditUnload, loadedRC.path, AuditUnloaded, nil, config.EnvDiff(currentEnv, previousEnv))
+	}
+
 	if toLoad == "" {
 		logStatus(config, "unloading")
 		newEnv = previousEnv.Copy()
 		newEnv.CleanContext()
 	} else {
-		newEnv, err = config.EnvFromRC(toLoad, previousEnv)
+		if config.AsyncLoad {
+			var pending bool
+			newEnv, pending, err = config.AsyncEnvFromRC(toLoad, previousEnv)
+			if pending {
+				// Only unload until the worker is done. The DIRENV_* markers
+				// aren't part of the diff: they stay for the next prompt to
+				// revert to the same environment and pick up the result.
+				newEnv = previousEnv
+			}
+		} else {
+			newEnv, err = config.EnvFromRC(toLoad, previousEnv)
+		}
 		if err != nil {
 			logDebug("err: %v", err)
 			// If loading fails, fall through and deliver a diff anyway,
@@ -104,11 +128,11 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		}
 	}
 
-	if out := diffStatus(previousEnv.Diff(newEnv)); out != "" && !config.HideEnvDiff {
+	if out := diffStatus(config.EnvDiff(previousEnv, newEnv)); out != "" && !config.HideEnvDiff {
 		logStatus(config, "export %s", out)
 	}
 
-	diffString, diffErr := currentEnv.Diff(newEnv).ToShell(shell)
+	diffString, diffErr := config.EnvDiff(currentEnv, newEnv).ToShell(shell)
 	if diffErr != nil {
 		return fmt.Errorf("ToShell() failed: %w", diffErr)
 	}
@@ -118,6 +142,67 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 	return
 }
 
+// approvalLapsed returns true if the approval of the loaded RC expired while
+// its environment is still applied.
+func approvalLapsed(config *Config, rc *RC) bool {
+	record := rc.AllowRecord()
+	if record == nil || !record.Expired(time.Now()) {
+		return false
+	}
+	// Once blocked, the RC doesn't change the environment anymore: no need to
+	// reload again on each prompt
+	diffString, _ := config.Env.loadedState()
+	diff, err := LoadEnvDiff(diffString)
+	if err != nil {
+		return false
+	}
+	for _, vars := range []map[string]string{diff.Prev, diff.Next} {
+		for key := range vars {
+			if !direnvKey(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeDrifted applies the on_drift option to the variables that were changed
+// by hand since the RC was loaded, and that Revert() just reset in
+// previousEnv.
+func mergeDrifted(config *Config, currentEnv, previousEnv Env) error {
+	changed, err := config.Drifted(currentEnv)
+	if err != nil {
+		return err
+	}
+	// Variables that are already back to their previous value, like after an
+	// unload while loading in the background, have nothing to revert
+	var drifted []string
+	for _, key := range changed {
+		current, inCurrent := currentEnv[key]
+		previous, inPrevious := previousEnv[key]
+		if inCurrent != inPrevious || current != previous {
+			drifted = append(drifted, key)
+		}
+	}
+	if len(drifted) == 0 {
+		return nil
+	}
+	switch config.OnDrift {
+	case DriftKeep:
+		for _, key := range drifted {
+			if value, ok := currentEnv[key]; ok {
+				previousEnv[key] = value
+			} else {
+				delete(previousEnv, key)
+			}
+		}
+		logStatus(config, "keeping the manually changed %s", strings.Join(drifted, " "))
+	case DriftWarn:
+		logError(config, "reverting the manually changed %s", strings.Join(drifted, " "))
+	}
+	return nil
+}
+
 // Return a string of +/-/~ indicators of an environment diff
 func diffStatus(oldDiff *EnvDiff) string {
 	if oldDiff.Any() {
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// CmdFreeze is `direnv freeze [--lockfile PATH] [PATH_TO_RC]`
+var CmdFreeze = &Cmd{
+	Name: "freeze",
+	Desc: `Evaluates the .envrc or .env and records the variables it sets in a
+  lockfile, direnv.lock next to it by default. Paths under the project root
+  and $HOME are normalized so it can be checked on other machines with
+  ` + "`direnv verify`.",
+	Args:   []string{"[--lockfile PATH]", "[PATH_TO_RC]"},
+	Action: actionWithConfig(cmdFreezeAction),
+}
+
+func cmdFreezeAction(env Env, args []string, config *Config) error {
+	rc, lockPath, err := parseLockfileArgs(args[1:], config)
+	if err != nil {
+		return err
+	}
+
+	lock, err := freezeRC(rc, env, config)
+	if err != nil {
+		return err
+	}
+	if err = lock.Write(lockPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("direnv: wrote %s\n", lockPath)
+	return nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// CmdProfile is `direnv profile [show|set|unset]`
+var CmdProfile = &Cmd{
+	Name: "profile",
+	Desc: `Selects the profile of the current .envrc, which loads .envrc.PROFILE
+  on top of it.
+  show [DIR]: prints the active profile
+  set PROFILE [DIR]: activates PROFILE
+  unset [DIR]: deactivates the profile`,
+	Args:   []string{"[show|set|unset]", "[PROFILE]", "[DIR]"},
+	Action: actionWithConfig(cmdProfileAction),
+}
+
+func cmdProfileAction(_ Env, args []string, config *Config) (err error) {
+	subCommand := "show"
+	if len(args) > 1 {
+		subCommand = args[1]
+	}
+
+	var profile, dirArg string
+	switch subCommand {
+	case "show", "unset":
+		if len(args) > 2 {
+			dirArg = args[2]
+		}
+	case "set":
+		if len(args) < 3 {
+			return fmt.Errorf("missing the profile to set")
+		}
+		profile = args[2]
+		if len(args) > 3 {
+			dirArg = args[3]
+		}
+	default:
+		return fmt.Errorf("unknown profile sub-command %q", subCommand)
+	}
+
+	rc, err := findRCArg(dirArg, config)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(rc.Path())
+
+	switch subCommand {
+	case "show":
+		if profile, err = config.Profile(dir); err != nil {
+			return err
+		}
+		if profile != "" {
+			fmt.Println(profile)
+		}
+		return nil
+	case "set":
+		if err = config.SetProfile(dir, profile); err != nil {
+			return err
+		}
+		profilePath := profileRCPath(rc.Path(), profile)
+		if !fileExists(profilePath) {
+			logError(config, "%s not found, only %s will be loaded", profilePath, rc.Path())
+		} else if profileRC, err := RCFromPath(profilePath, config); err == nil && profileRC.Allowed() == NotAllowed {
+			logStatus(config, "%s is blocked. Run `direnv allow %s` to approve its content", profilePath, profilePath)
+		}
+	default:
+		if err = config.SetProfile(dir, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
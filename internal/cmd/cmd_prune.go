@@ -1,100 +1,131 @@
 package cmd
 
 import (
-	"log"
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 // CmdPrune is `direnv prune`
 var CmdPrune = &Cmd{
 	Name:   "prune",
-	Desc:   "Removes old allowed and required files",
+	Desc:   "Removes old, outdated or expired allowed and required files, cached environments and unused states",
 	Action: actionWithConfig(cmdPruneAction),
 }
 
 func cmdPruneAction(_ Env, _ []string, config *Config) (err error) {
-	var dir *os.File
-	var fi os.FileInfo
-	var dirList []string
-	var envrc []byte
+	now := time.Now()
 
 	// Track valid envrc paths for pruning required directory
 	validEnvrcs := make(map[string]string) // pathHash -> envrcPath
+	// The outdated records of the envrcs that got edited since allowed
+	outdated := make(map[string]string) // allow file -> envrcPath
 
-	allowed := config.AllowDir()
-	if dir, err = os.Open(allowed); err != nil {
-		return err
-	}
-	defer func() {
-		if err := dir.Close(); err != nil {
-			log.Printf("Warning: failed to close directory: %v", err)
+	err = eachAllowRecord(config, func(hash string, record *AllowRecord) error {
+		filename := path.Join(config.AllowDir(), hash)
+		envrcStr := record.Path
+
+		if !fileExists(envrcStr) || record.Expired(now) {
+			_ = os.Remove(filename)
+			return nil
 		}
-	}()
 
-	if dirList, err = dir.Readdirnames(0); err != nil {
+		ph, err := pathHash(envrcStr)
+		if err != nil {
+			logError(config, "skipping %s: %v", envrcStr, err)
+			return nil
+		}
+		h, err := rcHash(envrcStr, config)
+		if err != nil {
+			// Keep what belongs to it, it might be readable again later
+			logError(config, "skipping %s: %v", envrcStr, err)
+			validEnvrcs[ph] = envrcStr
+			return nil
+		}
+		if h != hash {
+			outdated[filename] = envrcStr
+		} else {
+			// This envrc is still valid, track it
+			validEnvrcs[ph] = envrcStr
+		}
+		return nil
+	}, func(filename string) {
+		// Records that can't be parsed can't be used either
+		_ = os.Remove(filename)
+	})
+	if err != nil {
 		return err
 	}
 
-	for _, hash := range dirList {
-		filename := path.Join(allowed, hash)
-		if fi, err = os.Stat(filename); err != nil {
-			return err
+	// Remove the outdated hashes once the envrc has been allowed again. Until
+	// then, they keep the allowed content, to review the changes.
+	keepContent := make(map[string]bool)
+	keep := func(envrcStr string) {
+		// The copies of the layers go with the one of the envrc
+		for _, p := range append([]string{envrcStr}, config.layerCandidates(envrcStr)...) {
+			if ph, err := pathHash(p); err == nil {
+				keepContent[ph] = true
+			}
+		}
+	}
+	for _, envrcStr := range validEnvrcs {
+		keep(envrcStr)
+	}
+	for filename, envrcStr := range outdated {
+		ph, _ := pathHash(envrcStr)
+		if _, valid := validEnvrcs[ph]; valid {
+			_ = os.Remove(filename)
+		} else {
+			keep(envrcStr)
 		}
+	}
 
-		if !fi.IsDir() {
-			if envrc, err = os.ReadFile(filename); err != nil {
-				return err
-			}
-			envrcStr := strings.TrimSpace(string(envrc))
+	if err = pruneAllowContentDir(config, keepContent); err != nil {
+		return err
+	}
 
-			// skip old files, w/o path inside
-			if envrcStr == "" {
-				continue
-			}
-			if !fileExists(envrcStr) {
-				_ = os.Remove(filename)
-			} else {
-				// remove outdated hashes
-				h, err := fileHash(envrcStr)
-				if err != nil {
-					return err
-				}
-				if h != hash {
-					_ = os.Remove(filename)
-				} else {
-					// This envrc is still valid, track it
-					if ph, err := pathHash(envrcStr); err == nil {
-						validEnvrcs[ph] = envrcStr
-					}
-				}
-			}
+	if err = pruneEnvCache(config); err != nil {
+		return err
+	}
 
-		}
+	if err = pruneAsyncLoads(config); err != nil {
+		return err
+	}
+
+	if err = pruneProfiles(config); err != nil {
+		return err
+	}
 
+	if err = pruneStates(config); err != nil {
+		return err
 	}
 
 	// Prune orphaned and outdated allowed-required files
 	return pruneAllowedRequiredDir(config, validEnvrcs)
 }
 
-func pruneAllowedRequiredDir(config *Config, validEnvrcs map[string]string) error {
-	allowedRequiredDir := config.AllowedRequiredDir()
-	dir, err := os.Open(allowedRequiredDir)
+// pruneAllowContentDir removes the copies of allowed content for RC files that
+// are gone or whose allow records expired.
+func pruneAllowContentDir(config *Config, keepContent map[string]bool) error {
+	allowContentDir := config.AllowContentDir()
+	dirList, err := readDirNames(allowContentDir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
-	defer func() {
-		if err := dir.Close(); err != nil {
-			log.Printf("Warning: failed to close directory: %v", err)
+
+	for _, envrcPathHash := range dirList {
+		if !keepContent[envrcPathHash] {
+			_ = os.Remove(path.Join(allowContentDir, envrcPathHash))
 		}
-	}()
+	}
 
-	dirList, err := dir.Readdirnames(0)
+	return nil
+}
+
+func pruneAllowedRequiredDir(config *Config, validEnvrcs map[string]string) error {
+	allowedRequiredDir := config.AllowedRequiredDir()
+	dirList, err := readDirNames(allowedRequiredDir)
 	if err != nil {
 		return err
 	}
@@ -119,20 +150,7 @@ func pruneAllowedRequiredDir(config *Config, validEnvrcs map[string]string) erro
 }
 
 func pruneAllowedRequiredFiles(allowedRequiredSubdir, envrcDir string) error {
-	dir, err := os.Open(allowedRequiredSubdir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-	defer func() {
-		if err := dir.Close(); err != nil {
-			log.Printf("Warning: failed to close directory: %v", err)
-		}
-	}()
-
-	files, err := dir.Readdirnames(0)
+	files, err := readDirNames(allowedRequiredSubdir)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPruneKeepsEditedContent(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}}
+	rcPath := filepath.Join(t.TempDir(), ".envrc")
+	if err := os.WriteFile(rcPath, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(rcPath, []byte("export FOO=baz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Several prunes keep the allowed content while the envrc isn't allowed again
+	for i := 0; i < 2; i++ {
+		if err = cmdPruneAction(nil, nil, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	review, err := rc.ReviewDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(review, "-export FOO=bar") {
+		t.Errorf("expected the allowed content to be kept, got:\n%s", review)
+	}
+
+	// Once allowed again, the outdated record goes
+	rc, err = RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmdPruneAction(nil, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	names, err := readDirNames(config.AllowDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("expected only the current allow record, got %v", names)
+	}
+
+	// And everything goes with the envrc
+	if err = os.Remove(rcPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmdPruneAction(nil, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := rc.AllowedContent(rcPath); content != nil {
+		t.Errorf("expected the allowed content to be removed, got %q", content)
+	}
+}
+
+func TestPruneInvalidRecords(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}}
+	rcPath := filepath.Join(t.TempDir(), ".envrc")
+	if err := os.WriteFile(rcPath, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(config.AllowDir(), "invalid")
+	if err = os.WriteFile(invalid, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A bad record doesn't hide the other ones
+	entries, err := LoadTrustEntries(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Status != TrustAllowed {
+		t.Errorf("expected the allowed entry, got %v", entries)
+	}
+
+	if err = cmdPruneAction(nil, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(invalid); !os.IsNotExist(err) {
+		t.Errorf("expected the invalid record to be removed, got %v", err)
+	}
+	if rc.Allowed() != Allowed {
+		t.Error("expected the valid record to be kept")
+	}
+}
+
+func TestPruneKeepsLayerContent(t *testing.T) {
+	root := t.TempDir()
+	local := filepath.Join(root, ".envrc.local")
+	for _, path := range []string{filepath.Join(root, ".envrc"), local} {
+		if err := os.WriteFile(path, []byte("export FOO=bar\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc", ".envrc.local"}}
+	rc, err := FindRC(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cmdPruneAction(nil, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := rc.AllowedContent(local); content == nil {
+		t.Error("expected the allowed content of the layer to be kept")
+	}
+}
+
+func TestPruneKeepsUnreadableRecords(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any file")
+	}
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}}
+	if err := os.MkdirAll(config.AllowDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	unreadable := filepath.Join(config.AllowDir(), "unreadable")
+	if err := os.WriteFile(unreadable, []byte("/foo/.envrc\n"), 0000); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record that can't be read now isn't necessarily invalid
+	if err := cmdPruneAction(nil, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(unreadable); err != nil {
+		t.Errorf("expected the unreadable record to be kept, got %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // CmdStatus is `direnv status`
@@ -41,6 +43,16 @@ var CmdStatus = &Cmd{
 			} else {
 				jsonOutput["state"].(map[string]interface{})["foundRC"] = nil
 			}
+			pendingLoads, err := config.PendingLoads()
+			if err != nil {
+				return err
+			}
+			jsonOutput["state"].(map[string]interface{})["pendingLoads"] = pendingLoads
+			drifted, err := config.Drifted(config.Env)
+			if err != nil {
+				return err
+			}
+			jsonOutput["state"].(map[string]interface{})["drifted"] = drifted
 			jsonBytes, err := json.MarshalIndent(jsonOutput, "", "  ")
 			if err != nil {
 				fmt.Println(err)
@@ -53,9 +65,25 @@ var CmdStatus = &Cmd{
 
 			fmt.Println("bash_path", config.BashPath)
 			fmt.Println("disable_stdin", config.DisableStdin)
+			fmt.Println("rc_names", config.RCNames)
 			fmt.Println("warn_timeout", config.WarnTimeout)
+			fmt.Println("load_timeout", config.LoadTimeout)
+			fmt.Println("cache", config.CacheEnv)
+			fmt.Println("async_load", config.AsyncLoad)
+			fmt.Println("private_state", config.PrivateState)
+			fmt.Println("load_parents", config.LoadParents)
+			fmt.Println("load_parents_boundary", config.ParentsBoundary)
+			fmt.Println("diff.on_drift", config.OnDrift)
 			fmt.Println("whitelist.prefix", config.WhitelistPrefix)
 			fmt.Println("whitelist.exact", config.WhitelistExact)
+			fmt.Println("whitelist.glob", config.WhitelistGlob)
+			fmt.Println("whitelist.regex", config.WhitelistRegex)
+			fmt.Println("blacklist.prefix", config.BlacklistPrefix)
+			fmt.Println("blacklist.exact", config.BlacklistExact)
+			fmt.Println("blacklist.glob", config.BlacklistGlob)
+			fmt.Println("blacklist.regex", config.BlacklistRegex)
+			fmt.Println("trust.git_remotes", config.TrustGitRemotes)
+			fmt.Println("trust.public_keys", len(config.TrustPublicKeys))
 
 			loadedRC := config.LoadedRC()
 			foundRC, err := config.FindRC()
@@ -69,11 +97,30 @@ var CmdStatus = &Cmd{
 				fmt.Println("No .envrc or .env loaded")
 			}
 
+			drifted, err := config.Drifted(config.Env)
+			if err != nil {
+				return err
+			}
+			if len(drifted) > 0 {
+				fmt.Println("Loaded RC drifted", strings.Join(drifted, " "))
+			}
+
 			if foundRC != nil {
 				formatRC("Found", foundRC)
+				if profile, err := config.Profile(filepath.Dir(foundRC.path)); err == nil && profile != "" {
+					fmt.Println("Found RC profile", profile)
+				}
 			} else {
 				fmt.Println("No .envrc or .env found")
 			}
+
+			pendingLoads, err := config.PendingLoads()
+			if err != nil {
+				return err
+			}
+			for _, load := range pendingLoads {
+				fmt.Println("Pending load", load.Path, "since", load.Started.Local().Format(time.RFC3339))
+			}
 		}
 		return nil
 	}),
@@ -88,4 +135,7 @@ func formatRC(desc string, rc *RC) {
 	}
 	fmt.Println(desc, "RC allowed", rc.Allowed())
 	fmt.Println(desc, "RC allowPath", rc.allowPath)
+	if record := rc.AllowRecord(); record != nil && record.ExpiresAt != nil {
+		fmt.Println(desc, "RC allow expires", record.ExpiresAt.Local().Format(time.RFC3339))
+	}
 }
@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CmdTrust is `direnv trust SUBCOMMAND`
+var CmdTrust = &Cmd{
+	Name: "trust",
+	Desc: `Inspects the allowed, denied and required files.
+  list [--json]: lists every known .envrc or .env with its status
+  show [--json] [PATH_TO_RC]: shows the details of the given .envrc or .env
+  sign --key KEY_FILE [--manifest MANIFEST] [PATH_TO_RC...]: approves the
+    given .envrc or .env files in a team-shared manifest signed with KEY_FILE
+  export: prints the allowed and denied files as JSON
+  import [--rebase OLD=NEW]... FILE: imports the output of export, only
+    allowing the files whose content didn't change`,
+	Args:   []string{"list|show|sign|export|import", "[--json]", "[PATH_TO_RC]"},
+	Action: actionWithConfig(cmdTrustAction),
+}
+
+func cmdTrustAction(_ Env, args []string, config *Config) error {
+	if len(args) < 2 {
+		return fmt.Errorf("missing trust sub-command")
+	}
+
+	var jsonOutput bool
+	var rest []string
+	for _, arg := range args[2:] {
+		if arg == "-json" || arg == "--json" {
+			jsonOutput = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+
+	switch args[1] {
+	case "list":
+		return cmdTrustList(config, jsonOutput)
+	case "show":
+		return cmdTrustShow(config, rest, jsonOutput)
+	case "sign":
+		return cmdTrustSign(config, rest)
+	case "export":
+		return cmdTrustExport(config)
+	case "import":
+		return cmdTrustImport(config, rest)
+	default:
+		return fmt.Errorf("unknown trust sub-command %q", args[1])
+	}
+}
+
+func cmdTrustList(config *Config, jsonOutput bool) error {
+	entries, err := LoadTrustEntries(config)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(entries)
+	}
+
+	for _, entry := range entries {
+		fmt.Printf("%-8s %s\n", entry.Status, entry.Path)
+		for _, required := range entry.Required {
+			fmt.Printf("%-8s   requires %s (%s)\n", "", required.Path, requiredState(required))
+		}
+	}
+	return nil
+}
+
+func cmdTrustShow(config *Config, args []string, jsonOutput bool) (err error) {
+	var rcPath string
+	if len(args) > 0 {
+		rcPath = args[0]
+	}
+	rc, err := findRCArg(rcPath, config)
+	if err != nil {
+		return err
+	}
+
+	entries, err := LoadTrustEntries(config)
+	if err != nil {
+		return err
+	}
+	entry := &TrustEntry{Path: rc.Path(), Status: TrustUnknown}
+	for _, e := range entries {
+		if e.Path == rc.Path() {
+			entry = e
+			break
+		}
+	}
+
+	if jsonOutput {
+		return printJSON(entry)
+	}
+
+	fmt.Println("path:", entry.Path)
+	fmt.Println("status:", entry.Status)
+	if record := entry.Record; record != nil {
+		if record.AllowedBy != "" {
+			fmt.Println("allowed by:", record.AllowedBy)
+		}
+		if !record.AllowedAt.IsZero() {
+			fmt.Println("allowed at:", record.AllowedAt.Local().Format(time.RFC3339))
+		}
+		if record.Version != "" {
+			fmt.Println("direnv version:", record.Version)
+		}
+		if record.Reason != "" {
+			fmt.Println("reason:", record.Reason)
+		}
+		if record.ExpiresAt != nil {
+			fmt.Println("expires at:", record.ExpiresAt.Local().Format(time.RFC3339))
+		}
+	}
+	for _, required := range entry.Required {
+		fmt.Printf("requires: %s (%s)\n", required.Path, requiredState(required))
+	}
+	return nil
+}
+
+func cmdTrustSign(config *Config, args []string) (err error) {
+	var keyPath, manifestPath string
+	var rcPaths []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch name {
+		case "--key", "--manifest":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return fmt.Errorf("%s requires an argument", name)
+				}
+				i++
+				value = args[i]
+			}
+			if name == "--key" {
+				keyPath = value
+			} else {
+				manifestPath = value
+			}
+		default:
+			rcPaths = append(rcPaths, args[i])
+		}
+	}
+	if keyPath == "" {
+		return fmt.Errorf("--key is required")
+	}
+	key, err := LoadTrustPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if manifestPath == "" {
+		manifestPath = defaultTrustManifestPath(wd)
+	}
+	if manifestPath, err = filepath.Abs(manifestPath); err != nil {
+		return err
+	}
+	root, err := trustManifestRoot(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	project, err := trustManifestProject(root)
+	if err != nil {
+		return fmt.Errorf("the manifest is bound to the origin remote of the project: %w", err)
+	}
+
+	manifest := &TrustManifest{Version: 1}
+	if fileExists(manifestPath) {
+		if manifest, err = LoadTrustManifest(manifestPath); err != nil {
+			return err
+		}
+	}
+	manifest.SetProject(project)
+
+	if len(rcPaths) == 0 {
+		rcPaths = []string{""}
+	}
+	for _, rcPath := range rcPaths {
+		rc, err := findRCArg(rcPath, config)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, rc.Path())
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			return fmt.Errorf("%s is outside of the project root %s", rc.Path(), root)
+		}
+		content, err := os.ReadFile(rc.Path())
+		if err != nil {
+			return err
+		}
+		manifest.Set(relPath, content)
+		fmt.Printf("direnv: approving %s\n", relPath)
+	}
+
+	manifest.Sign(key)
+	if err = manifest.Write(manifestPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("direnv: signed %s\n", manifestPath)
+	fmt.Printf("direnv: add this key to the [trust] public_keys of direnv.toml to trust it:\n%s\n",
+		FormatTrustPublicKey(key.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+func cmdTrustExport(config *Config) error {
+	export, err := ExportTrust(config)
+	if err != nil {
+		return err
+	}
+	return printJSON(export)
+}
+
+func cmdTrustImport(config *Config, args []string) error {
+	var rebases [][2]string
+	var importPath string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--rebase" {
+			if importPath != "" {
+				return fmt.Errorf("unexpected argument %q", args[i])
+			}
+			importPath = args[i]
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("--rebase requires an argument")
+			}
+			i++
+			value = args[i]
+		}
+		from, to, ok := strings.Cut(value, "=")
+		if !ok || from == "" {
+			return fmt.Errorf("invalid --rebase %q, expected OLD=NEW", value)
+		}
+		rebases = append(rebases, [2]string{filepath.Clean(from), filepath.Clean(to)})
+	}
+	if importPath == "" {
+		return fmt.Errorf("missing the file to import")
+	}
+
+	var data []byte
+	var err error
+	if importPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(importPath)
+	}
+	if err != nil {
+		return err
+	}
+	export := new(TrustExport)
+	if err = json.Unmarshal(data, export); err != nil {
+		return fmt.Errorf("invalid trust export %s: %w", importPath, err)
+	}
+
+	rebase := func(path string) string {
+		for _, r := range rebases {
+			if path == r[0] || strings.HasPrefix(path, r[0]+string(filepath.Separator)) {
+				return r[1] + path[len(r[0]):]
+			}
+		}
+		return path
+	}
+
+	imported, skipped, err := ImportTrust(config, export, rebase)
+	for _, msg := range skipped {
+		fmt.Printf("direnv: skipping %s\n", msg)
+	}
+	fmt.Printf("direnv: imported %d of %d entries\n", imported, len(export.Entries))
+	return err
+}
+
+// defaultTrustManifestPath returns the nearest existing manifest, or a new
+// one at the root of the enclosing git repository or the current directory.
+func defaultTrustManifestPath(wd string) string {
+	if manifestPath, _ := findTrustManifest(wd); manifestPath != "" {
+		return manifestPath
+	}
+	if repo := findGitRepo(wd); repo != nil {
+		return filepath.Join(repo.workTree, TrustManifestPath)
+	}
+	return filepath.Join(wd, TrustManifestPath)
+}
+
+// findRCArg finds the RC file from a PATH_TO_RC argument, defaulting to the
+// current directory.
+func findRCArg(rcPath string, config *Config) (rc *RC, err error) {
+	if rcPath != "" {
+		if rcPath, err = filepath.Abs(rcPath); err != nil {
+			return nil, err
+		}
+		if rcPath, err = filepath.EvalSymlinks(rcPath); err != nil {
+			return nil, err
+		}
+	} else {
+		if rcPath, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+
+	rc, err = FindRC(rcPath, config)
+	if err != nil {
+		return nil, err
+	} else if rc == nil {
+		return nil, config.rcNotFound()
+	}
+	return rc, nil
+}
+
+func requiredState(required RequiredEntry) string {
+	if required.Current {
+		return "allowed"
+	}
+	return "stale"
+}
+
+func printJSON(v interface{}) error {
+	jsonBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(jsonBytes))
+	return nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// CmdVerify is `direnv verify [--lockfile PATH] [PATH_TO_RC]`
+var CmdVerify = &Cmd{
+	Name: "verify",
+	Desc: `Evaluates the .envrc or .env and checks that the variables it sets
+  still match the lockfile written by ` + "`direnv freeze`." + ` Prints the
+  differences and exits with an error otherwise.`,
+	Args:   []string{"[--lockfile PATH]", "[PATH_TO_RC]"},
+	Action: actionWithConfig(cmdVerifyAction),
+}
+
+func cmdVerifyAction(env Env, args []string, config *Config) error {
+	rc, lockPath, err := parseLockfileArgs(args[1:], config)
+	if err != nil {
+		return err
+	}
+
+	locked, err := LoadLockfile(lockPath)
+	if err != nil {
+		return err
+	}
+	current, err := freezeRC(rc, env, config)
+	if err != nil {
+		return err
+	}
+
+	diff := unifiedDiff(lockPath, rc.Path(), locked.lines(), current.lines())
+	if diff == "" {
+		fmt.Printf("direnv: %s matches %s\n", rc.Path(), lockPath)
+		return nil
+	}
+	fmt.Print(diff)
+	return fmt.Errorf("the environment of %s differs from %s. Run `direnv freeze` to update it", rc.Path(), lockPath)
+}
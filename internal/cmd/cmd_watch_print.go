@@ -15,13 +15,13 @@ var CmdWatchPrint = &Cmd{
 
 func cmdWatchPrintAction(env Env, args []string) (err error) {
 	watches := NewFileTimes()
-	watchString, ok := env[DIRENV_WATCHES]
+	_, watchString := env.loadedState()
 	separator := '\n'
 	if len(args) > 1 && args[1] == "--null" {
 		separator = 0
 	}
 
-	if ok {
+	if watchString != "" {
 		err = watches.Unmarshal(watchString)
 		if err != nil {
 			return
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CmdWhy is `direnv why VAR [PATH_TO_RC]`
+var CmdWhy = &Cmd{
+	Name: "why",
+	Desc: `Evaluates the .envrc or .env again and shows which files and stdlib
+  functions changed the given variable, in order.`,
+	Args:   []string{"[--show-secrets]", "VAR", "[PATH_TO_RC]"},
+	Action: actionWithConfig(cmdWhyAction),
+}
+
+func cmdWhyAction(env Env, args []string, config *Config) error {
+	var key, rcPath string
+	var showSecrets bool
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--show-secrets":
+			showSecrets = true
+		case key == "":
+			key = arg
+		case rcPath == "":
+			rcPath = arg
+		default:
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+	if key == "" {
+		return fmt.Errorf("missing the variable to explain")
+	}
+
+	rc, err := findRCArg(rcPath, config)
+	if err != nil {
+		return err
+	}
+
+	previousEnv, err := config.Revert(env)
+	if err != nil {
+		return err
+	}
+	previousEnv.CleanContext()
+
+	// Always evaluate, with the snapshots enabled
+	config.CacheEnv = false
+	config.PrivateState = false
+	config.provenance = make(Provenance)
+	newEnv, err := rc.Load(previousEnv)
+	if err != nil {
+		return err
+	}
+
+	changes := config.provenance[key]
+	if len(changes) == 0 {
+		if _, ok := previousEnv[key]; ok {
+			fmt.Printf("%s is not changed by %s, it comes from the environment\n", key, rc.Path())
+		} else {
+			fmt.Printf("%s is not set by %s\n", key, rc.Path())
+		}
+		return nil
+	}
+
+	fmt.Print(formatProvenance(key, changes, config.DiffOptions.ListKeys[key], showSecrets))
+	// The current value only comes from this RC if it is the loaded one
+	if loadedRC := config.LoadedRC(); loadedRC == nil || loadedRC.Path() != rc.Path() {
+		return nil
+	}
+	if value, ok := env[key]; ok && value != newEnv[key] {
+		fmt.Printf("%s was changed since %s was loaded\n", key, rc.Path())
+	}
+	return nil
+}
+
+// formatProvenance renders the changes of key, each followed by the stack of
+// calls that made it, innermost first. The changes of list variables, as
+// told by isList, are detailed element by element.
+func formatProvenance(key string, changes []*ProvenanceChange, isList, showSecrets bool) string {
+	var b strings.Builder
+	for _, change := range changes {
+		e := newDiffEntry(key, change.Old, change.New)
+		if e.Change == "changed" && isList {
+			prev, next := splitList(*e.Old), splitList(*e.New)
+			e.Added = subtractList(next, prev)
+			e.Removed = subtractList(prev, next)
+		}
+		if !showSecrets {
+			e.maskSecret()
+		}
+		b.WriteString(formatDiffEntries([]*diffEntry{e}, false))
+		for i := len(change.Calls) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "    at %s\n", change.Calls[i])
+		}
+	}
+	return b.String()
+}
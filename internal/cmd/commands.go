@@ -47,26 +47,34 @@ func init() {
 	CmdList = []*Cmd{
 		CmdAllow,
 		CmdApplyDump,
+		CmdAsyncLoad,
+		CmdAudit,
 		CmdShowDump,
 		CmdCheckRequired,
 		CmdDeny,
+		CmdDiff,
 		CmdDotEnv,
 		CmdDump,
 		CmdEdit,
 		CmdExec,
 		CmdExport,
 		CmdFetchURL,
+		CmdFreeze,
 		CmdHelp,
 		CmdHook,
+		CmdProfile,
 		CmdPrune,
 		CmdReload,
 		CmdStatus,
 		CmdStdlib,
+		CmdTrust,
+		CmdVerify,
 		CmdVersion,
 		CmdWatch,
 		CmdWatchDir,
 		CmdWatchList,
 		CmdWatchPrint,
+		CmdWhy,
 		CmdCurrent,
 		CmdLog,
 	}
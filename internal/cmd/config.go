@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"os"
 	"os/exec"
@@ -28,12 +29,34 @@ type Config struct {
 	DisableStdin    bool
 	StrictEnv       bool
 	LoadDotenv      bool
+	RCNames         []string
+	AuditLog        bool
+	CacheEnv        bool
+	AsyncLoad       bool
+	PrivateState    bool
+	LoadParents     bool
+	ParentsBoundary string
 	LogFormat       string
 	LogFilter       *regexp.Regexp
 	LogColor        bool
 	WarnTimeout     time.Duration
+	LoadTimeout     time.Duration
+	OnDrift         string
+	DiffOptions     *EnvDiffOptions
 	WhitelistPrefix []string
 	WhitelistExact  map[string]bool
+	WhitelistGlob   []string
+	WhitelistRegex  []*regexp.Regexp
+	BlacklistPrefix []string
+	BlacklistExact  map[string]bool
+	BlacklistGlob   []string
+	BlacklistRegex  []*regexp.Regexp
+	TrustGitRemotes []string
+	TrustPublicKeys []ed25519.PublicKey
+
+	// provenance records the changes made by each call while loading, when
+	// set by `direnv why`
+	provenance Provenance
 }
 
 type tomlDuration struct {
@@ -50,6 +73,9 @@ type tomlConfig struct {
 	*tomlGlobal               // For backward-compatibility
 	Global      *tomlGlobal   `toml:"global"`
 	Whitelist   tomlWhitelist `toml:"whitelist"`
+	Blacklist   tomlWhitelist `toml:"blacklist"`
+	Trust       tomlTrust     `toml:"trust"`
+	Diff        tomlDiff      `toml:"diff"`
 }
 
 type tomlGlobal struct {
@@ -58,8 +84,16 @@ type tomlGlobal struct {
 	StrictEnv    bool          `toml:"strict_env"`
 	SkipDotenv   bool          `toml:"skip_dotenv"` // deprecated, use load_dotenv
 	LoadDotenv   bool          `toml:"load_dotenv"`
+	RCNames      []string      `toml:"rc_names"`
 	WarnTimeout  *tomlDuration `toml:"warn_timeout"`
+	LoadTimeout  *tomlDuration `toml:"load_timeout"`
 	HideEnvDiff  bool          `toml:"hide_env_diff"`
+	AuditLog     bool          `toml:"audit_log"`
+	Cache        bool          `toml:"cache"`
+	AsyncLoad    bool          `toml:"async_load"`
+	PrivateState bool          `toml:"private_state"`
+	LoadParents  bool          `toml:"load_parents"`
+	LoadBoundary string        `toml:"load_parents_boundary"`
 	LogFormat    string        `toml:"log_format"`
 	LogFilter    string        `toml:"log_filter"`
 }
@@ -67,6 +101,20 @@ type tomlGlobal struct {
 type tomlWhitelist struct {
 	Prefix []string `toml:"prefix"`
 	Exact  []string `toml:"exact"`
+	Glob   []string `toml:"glob"`
+	Regex  []string `toml:"regex"`
+}
+
+type tomlDiff struct {
+	ListKeys     []string `toml:"list_keys"`
+	OnDrift      string   `toml:"on_drift"`
+	Ignore       []string `toml:"ignore"`
+	IgnorePrefix []string `toml:"ignore_prefix"`
+}
+
+type tomlTrust struct {
+	GitRemotes []string `toml:"git_remotes"`
+	PublicKeys []string `toml:"public_keys"`
 }
 
 // Expand a path string prefixed with ~/ to the current user's home directory.
@@ -85,6 +133,41 @@ func expandTildePath(path string) (pathExpanded string) {
 	return pathExpanded
 }
 
+// exactRCPath turns an `exact` whitelist entry into the path of an RC file.
+// Directories are treated as if `/.envrc` had been appended to them.
+func exactRCPath(path string) string {
+	if !strings.HasSuffix(path, "/.envrc") && !strings.HasSuffix(path, "/.env") {
+		path = filepath.Join(path, ".envrc")
+	}
+	return expandTildePath(path)
+}
+
+// parseGlobs expands and validates the `glob` entries of the given section.
+func parseGlobs(section string, globs []string) ([]string, error) {
+	patterns := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		pattern := expandTildePath(glob)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s glob %q: %w", section, glob, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// parseRegexps compiles the `regex` entries of the given section.
+func parseRegexps(section string, exprs []string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s regex %q: %w", section, expr, err)
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
 // LoadConfig opens up the direnv configuration from the Env.
 func LoadConfig(env Env) (config *Config, err error) {
 	config = &Config{
@@ -121,10 +204,18 @@ func LoadConfig(env Env) (config *Config, err error) {
 	// Default log format
 	config.LogFormat = defaultLogFormat
 
+	// Keep the variables changed by hand on unload
+	config.OnDrift = DriftKeep
+
+	// Extended by the [diff] section
+	config.DiffOptions = DefaultEnvDiffOptions()
+
 	config.RCFile = env[DIRENV_FILE]
 
 	config.WhitelistPrefix = make([]string, 0)
 	config.WhitelistExact = make(map[string]bool)
+	config.BlacklistPrefix = make([]string, 0)
+	config.BlacklistExact = make(map[string]bool)
 
 	// Load the TOML config
 	config.TomlPath = filepath.Join(config.ConfDir, "direnv.toml")
@@ -178,11 +269,67 @@ func LoadConfig(env Env) (config *Config, err error) {
 		}
 
 		for _, path := range tomlConf.Whitelist.Exact {
-			if !strings.HasSuffix(path, "/.envrc") && !strings.HasSuffix(path, "/.env") {
-				path = filepath.Join(path, ".envrc")
+			config.WhitelistExact[exactRCPath(path)] = true
+		}
+
+		if config.WhitelistGlob, err = parseGlobs("whitelist", tomlConf.Whitelist.Glob); err != nil {
+			return nil, err
+		}
+
+		if config.WhitelistRegex, err = parseRegexps("whitelist", tomlConf.Whitelist.Regex); err != nil {
+			return nil, err
+		}
+
+		for _, path := range tomlConf.Blacklist.Prefix {
+			config.BlacklistPrefix = append(config.BlacklistPrefix, expandTildePath(path))
+		}
+
+		for _, path := range tomlConf.Blacklist.Exact {
+			config.BlacklistExact[exactRCPath(path)] = true
+		}
+
+		if config.BlacklistGlob, err = parseGlobs("blacklist", tomlConf.Blacklist.Glob); err != nil {
+			return nil, err
+		}
+
+		if config.BlacklistRegex, err = parseRegexps("blacklist", tomlConf.Blacklist.Regex); err != nil {
+			return nil, err
+		}
+
+		config.TrustGitRemotes = tomlConf.Trust.GitRemotes
+
+		for _, key := range tomlConf.Trust.PublicKeys {
+			pub, err := ParseTrustPublicKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trust public key: %w", err)
 			}
+			config.TrustPublicKeys = append(config.TrustPublicKeys, pub)
+		}
+
+		for _, key := range tomlConf.Diff.ListKeys {
+			config.DiffOptions.ListKeys[key] = true
+		}
+
+		for _, key := range tomlConf.Diff.Ignore {
+			if direnvKey(key) {
+				return nil, fmt.Errorf("invalid diff ignore %q, the DIRENV_ variables can't be ignored", key)
+			}
+			config.DiffOptions.IgnoredKeys[key] = true
+		}
 
-			config.WhitelistExact[expandTildePath(path)] = true
+		for _, prefix := range tomlConf.Diff.IgnorePrefix {
+			if direnvKey(prefix) || strings.HasPrefix("DIRENV_", prefix) {
+				return nil, fmt.Errorf("invalid diff ignore_prefix %q, the DIRENV_ variables can't be ignored", prefix)
+			}
+			config.DiffOptions.IgnoredPrefixes = append(config.DiffOptions.IgnoredPrefixes, prefix)
+		}
+
+		switch tomlConf.Diff.OnDrift {
+		case "":
+		case DriftKeep, DriftWarn, DriftRevert:
+			config.OnDrift = tomlConf.Diff.OnDrift
+		default:
+			return nil, fmt.Errorf("invalid on_drift %q, expected %q, %q or %q", tomlConf.Diff.OnDrift, DriftKeep, DriftWarn, DriftRevert)
 		}
 
 		if tomlConf.SkipDotenv {
@@ -190,12 +337,29 @@ func LoadConfig(env Env) (config *Config, err error) {
 		}
 
 		config.BashPath = tomlConf.BashPath
+		config.AuditLog = tomlConf.AuditLog
+		config.CacheEnv = tomlConf.Cache
+		config.AsyncLoad = tomlConf.AsyncLoad
+		config.PrivateState = tomlConf.PrivateState
+		config.LoadParents = tomlConf.LoadParents
+		if tomlConf.LoadBoundary != "" {
+			config.ParentsBoundary = filepath.Clean(expandTildePath(tomlConf.LoadBoundary))
+		}
 		config.DisableStdin = tomlConf.DisableStdin
 		config.LoadDotenv = tomlConf.LoadDotenv
+		for _, name := range tomlConf.RCNames {
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+				return nil, fmt.Errorf("invalid rc_names entry %q, expected a file name", name)
+			}
+		}
+		config.RCNames = tomlConf.RCNames
 		config.StrictEnv = tomlConf.StrictEnv
 		if tomlConf.WarnTimeout != nil {
 			config.WarnTimeout = tomlConf.WarnTimeout.Duration
 		}
+		if tomlConf.LoadTimeout != nil {
+			config.LoadTimeout = tomlConf.LoadTimeout.Duration
+		}
 	}
 
 	if ts := env.Fetch("DIRENV_WARN_TIMEOUT", ""); ts != "" {
@@ -207,14 +371,31 @@ func LoadConfig(env Env) (config *Config, err error) {
 		}
 	}
 
+	if ts := env.Fetch("DIRENV_LOAD_TIMEOUT", ""); ts != "" {
+		timeout, err := time.ParseDuration(ts)
+		if err == nil {
+			config.LoadTimeout = timeout
+		} else {
+			logError(config, "invalid DIRENV_LOAD_TIMEOUT: "+err.Error())
+		}
+	}
+
+	if len(config.RCNames) == 0 {
+		config.RCNames = []string{".envrc", ".envrc.toml"}
+		if config.LoadDotenv {
+			config.RCNames = append(config.RCNames, ".env")
+		}
+	}
+
 	if config.BashPath == "" {
 		if env[DIRENV_BASH] != "" {
 			config.BashPath = env[DIRENV_BASH]
 		} else if bashPath != "" {
 			config.BashPath = bashPath
 		} else if config.BashPath, err = exec.LookPath("bash"); err != nil {
-			err = fmt.Errorf("can't find bash: %w", err)
-			return
+			// Only needed to evaluate the bash RC files, not .envrc.toml
+			logDebug("can't find bash: %v", err)
+			err = nil
 		}
 	}
 
@@ -247,6 +428,12 @@ func (config *Config) DenyDir() string {
 	return filepath.Join(config.DataDir, "deny")
 }
 
+// AllowContentDir is the folder where a copy of the last allowed content of
+// each RC file is stored.
+func (config *Config) AllowContentDir() string {
+	return filepath.Join(config.DataDir, "allow-content")
+}
+
 // AllowedRequiredDir is the folder where all the "allowed required" files are stored.
 func (config *Config) AllowedRequiredDir() string {
 	return filepath.Join(config.DataDir, "allowed-required")
@@ -260,11 +447,16 @@ func (config *Config) LoadedRC() *RC {
 	}
 	rcPath := config.Env[DIRENV_FILE]
 
-	timesString := config.Env[DIRENV_WATCHES]
+	_, timesString := config.Env.loadedState()
 
 	return RCFromEnv(rcPath, timesString, config)
 }
 
+// EnvDiff builds the diff from e1 to e2 with the diff options of the config.
+func (config *Config) EnvDiff(e1, e2 Env) *EnvDiff {
+	return BuildEnvDiffWith(e1, e2, config.DiffOptions)
+}
+
 // EnvFromRC loads an RC from a specified path and returns the new environment
 func (config *Config) EnvFromRC(path string, previousEnv Env) (Env, error) {
 	rc, err := RCFromPath(path, config)
@@ -282,12 +474,74 @@ func (config *Config) FindRC() (*RC, error) {
 // Revert undoes the recorded changes (if any) to the supplied environment,
 // returning a new environment
 func (config *Config) Revert(env Env) (Env, error) {
-	if config.Env[DIRENV_DIFF] == "" {
-		return env.Copy(), nil
+	diffString, _ := config.Env.loadedState()
+	if diffString == "" {
+		previousEnv := env.Copy()
+		delete(previousEnv, DIRENV_STATE)
+		return previousEnv, nil
 	}
-	diff, err := LoadEnvDiff(config.Env[DIRENV_DIFF])
-	if err == nil {
-		return diff.Reverse().Patch(env), nil
+	diff, err := LoadEnvDiff(diffString)
+	if err != nil {
+		return nil, err
+	}
+	// The state isn't part of the diff, it is set afterwards
+	previousEnv := diff.Reverse().Patch(env)
+	delete(previousEnv, DIRENV_STATE)
+	return previousEnv, nil
+}
+
+// Drifted returns the variables that were changed by hand since the RC was
+// loaded, according to the recorded changes.
+func (config *Config) Drifted(env Env) ([]string, error) {
+	diffString, _ := config.Env.loadedState()
+	if diffString == "" {
+		return nil, nil
 	}
-	return nil, err
+	diff, err := LoadEnvDiff(diffString)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Drifted(env), nil
+}
+
+// whitelisted returns true if the absolute path of an RC file matches any of
+// the [whitelist] rules.
+func (config *Config) whitelisted(path string) bool {
+	return matchPathRules(path, config.WhitelistExact, config.WhitelistPrefix, config.WhitelistGlob, config.WhitelistRegex)
+}
+
+// blacklisted returns true if the absolute path of an RC file matches any of
+// the [blacklist] rules.
+func (config *Config) blacklisted(path string) bool {
+	return matchPathRules(path, config.BlacklistExact, config.BlacklistPrefix, config.BlacklistGlob, config.BlacklistRegex)
+}
+
+func matchPathRules(path string, exact map[string]bool, prefixes []string, globs []string, regexps []*regexp.Regexp) bool {
+	// exact matches are O(1)ish to check, so look there first
+	if exact[path] {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	// globs match the directory of the RC file or any of its parents
+	for _, glob := range globs {
+		for _, dir := range eachDir(filepath.Dir(path)) {
+			if ok, _ := filepath.Match(glob, dir); ok {
+				return true
+			}
+		}
+	}
+
+	for _, re := range regexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestWhitelistBlacklist(t *testing.T) {
+	config := &Config{
+		WhitelistGlob:  []string{"/work/*/services/*"},
+		WhitelistRegex: []*regexp.Regexp{regexp.MustCompile(`^/src/[^/]+/trusted-`)},
+		BlacklistGlob:  []string{"/work/evil/*"},
+	}
+
+	for path, expected := range map[string]bool{
+		"/work/org/services/api/.envrc":     true,
+		"/work/org/services/api/sub/.envrc": true,
+		"/work/org/services/.envrc":         false,
+		"/work/org/other/api/.envrc":        false,
+		"/src/org/trusted-repo/.envrc":      true,
+		"/src/org/repo/.envrc":              false,
+	} {
+		if actual := config.whitelisted(path); actual != expected {
+			t.Errorf("whitelisted(%q) = %v, expected %v", path, actual, expected)
+		}
+	}
+
+	if !config.blacklisted("/work/evil/services/.envrc") {
+		t.Error("expected /work/evil/services/.envrc to be blacklisted")
+	}
+	if config.blacklisted("/work/org/services/api/.envrc") {
+		t.Error("expected /work/org/services/api/.envrc not to be blacklisted")
+	}
+}
+
+func TestLoadTimeoutFromEnv(t *testing.T) {
+	home := t.TempDir()
+	env := Env{"HOME": home, "DIRENV_CONFIG": home, "DIRENV_LOAD_TIMEOUT": "1m30s"}
+	config, err := LoadConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.LoadTimeout != 90*time.Second {
+		t.Errorf("LoadTimeout = %v, expected 1m30s", config.LoadTimeout)
+	}
+}
+
+func TestDiffIgnoreConfig(t *testing.T) {
+	home := t.TempDir()
+	tomlPath := filepath.Join(home, "direnv.toml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(tomlPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := Env{"HOME": home, "DIRENV_CONFIG": home}
+
+	writeConfig("[diff]\nignore = [\"TMUX_PANE\"]\nignore_prefix = [\"STARSHIP_\"]\nlist_keys = [\"CDPATH\"]\n")
+	config, err := LoadConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"TMUX_PANE", "STARSHIP_SESSION_KEY", "PS1"} {
+		if !config.DiffOptions.Ignored(key) {
+			t.Errorf("expected %s to be ignored", key)
+		}
+	}
+	if config.DiffOptions.Ignored("STARSHIP") {
+		t.Error("expected STARSHIP not to be ignored")
+	}
+	if !config.DiffOptions.ListKeys["CDPATH"] || !config.DiffOptions.ListKeys["PATH"] {
+		t.Error("expected CDPATH to be added to the list keys")
+	}
+
+	// The defaults are left alone
+	if IgnoredEnv("TMUX_PANE") || IgnoredEnv("STARSHIP_SESSION_KEY") || ListKeys["CDPATH"] {
+		t.Error("expected the config not to change the defaults")
+	}
+
+	writeConfig("[diff]\nignore_prefix = [\"DIR\"]\n")
+	if _, err := LoadConfig(env); err == nil {
+		t.Error("expected a prefix of DIRENV_ to be rejected")
+	}
+}
@@ -11,6 +11,12 @@ const (
 	DIRENV_WATCHES  = "DIRENV_WATCHES"
 	DIRENV_DIFF     = "DIRENV_DIFF"
 	DIRENV_REQUIRED = "DIRENV_REQUIRED"
+	DIRENV_PROFILE  = "DIRENV_PROFILE"
+	DIRENV_STATE    = "DIRENV_STATE"
 
 	DIRENV_DUMP_FILE_PATH = "DIRENV_DUMP_FILE_PATH"
+
+	DIRENV_PROVENANCE_FILE  = "DIRENV_PROVENANCE_FILE"
+	DIRENV_PROVENANCE_EVENT = "DIRENV_PROVENANCE_EVENT"
+	DIRENV_PROVENANCE_CALL  = "DIRENV_PROVENANCE_CALL"
 )
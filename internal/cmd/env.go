@@ -38,6 +38,8 @@ func (env Env) CleanContext() {
 	delete(env, DIRENV_DIFF)
 	delete(env, DIRENV_DIR)
 	delete(env, DIRENV_FILE)
+	delete(env, DIRENV_PROFILE)
+	delete(env, DIRENV_STATE)
 	delete(env, DIRENV_DUMP_FILE_PATH)
 	delete(env, DIRENV_WATCHES)
 }
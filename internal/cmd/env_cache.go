@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envCacheEntry is the result of an RC evaluation, stored in the cache dir.
+type envCacheEntry struct {
+	// Config holds the watches on the user's direnvrc and lib folder, which
+	// are sourced by the stdlib but not recorded in DIRENV_WATCHES.
+	Config string `json:"config"`
+	Env    Env    `json:"env"`
+}
+
+// EnvCacheDir is the folder where evaluated environments are cached.
+func (config *Config) EnvCacheDir() string {
+	return filepath.Join(config.CacheDir, "env")
+}
+
+// envCacheKey identifies an evaluation of the RC file from the given
+// environment. Variables that are ignored by the diff don't influence it.
+func (rc *RC) envCacheKey(previousEnv Env) string {
+	keys := make([]string, 0, len(previousEnv))
+	for key := range previousEnv {
+		if !rc.config.DiffOptions.Ignored(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	hasher := sha256.New()
+	_, _ = fmt.Fprintf(hasher, "%s\x00%s\x00", version, rc.path)
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(hasher, "%s=%s\x00", key, previousEnv[key])
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil))
+}
+
+// configTimes returns the watches on the user configuration that gets
+// sourced into every RC evaluation.
+func (config *Config) configTimes() (FileTimes, error) {
+	times := NewFileTimes()
+	for _, path := range []string{
+		filepath.Join(config.ConfDir, "direnvrc"),
+		filepath.Join(config.ConfDir, "lib"),
+	} {
+		if err := times.Update(path); err != nil {
+			return times, err
+		}
+	}
+	return times, nil
+}
+
+// loadCachedEnv returns the cached result of evaluating the RC file from
+// previousEnv, or nil if there is none or any of the watched files changed.
+func (rc *RC) loadCachedEnv(previousEnv Env) Env {
+	cachePath := filepath.Join(rc.config.EnvCacheDir(), rc.envCacheKey(previousEnv))
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil
+	}
+
+	var entry envCacheEntry
+	if err = json.Unmarshal(data, &entry); err != nil {
+		logDebug("env cache: %s: %v", cachePath, err)
+		return nil
+	}
+
+	for _, marshalled := range []string{entry.Config, entry.Env[DIRENV_WATCHES]} {
+		times := NewFileTimes()
+		if err = times.Unmarshal(marshalled); err != nil {
+			logDebug("env cache: %s: %v", cachePath, err)
+			return nil
+		}
+		if err = times.Check(); err != nil {
+			logDebug("env cache: %s: %v", cachePath, err)
+			return nil
+		}
+	}
+
+	return entry.Env
+}
+
+// storeCachedEnv records the result of evaluating the RC file from
+// previousEnv. Failing to write the cache is not fatal.
+func (rc *RC) storeCachedEnv(previousEnv, newEnv Env) {
+	configTimes, err := rc.config.configTimes()
+	if err != nil {
+		logDebug("env cache: %v", err)
+		return
+	}
+	data, err := json.Marshal(envCacheEntry{configTimes.Marshal(), newEnv})
+	if err != nil {
+		logDebug("env cache: %v", err)
+		return
+	}
+
+	cacheDir := rc.config.EnvCacheDir()
+	if err = os.MkdirAll(cacheDir, 0700); err != nil {
+		logDebug("env cache: %v", err)
+		return
+	}
+	// The environment might contain secrets, keep it private.
+	cachePath := filepath.Join(cacheDir, rc.envCacheKey(previousEnv))
+	if err = os.WriteFile(cachePath, data, 0600); err != nil {
+		logDebug("env cache: %v", err)
+	}
+}
+
+// pruneEnvCache removes the cached environments that can't be used anymore.
+func pruneEnvCache(config *Config) error {
+	cacheDir := config.EnvCacheDir()
+	names, err := readDirNames(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		cachePath := filepath.Join(cacheDir, name)
+		data, err := os.ReadFile(cachePath)
+		if err != nil {
+			continue
+		}
+		var entry envCacheEntry
+		times := NewFileTimes()
+		if json.Unmarshal(data, &entry) != nil ||
+			times.Unmarshal(entry.Env[DIRENV_WATCHES]) != nil ||
+			times.Check() != nil {
+			_ = os.Remove(cachePath)
+		}
+	}
+	return nil
+}
+
+// userRelPath replaces the home directory by ~, like `user_rel_path` in the
+// stdlib.
+func userRelPath(env Env, path string) string {
+	home := env["HOME"]
+	if home == "" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, home); ok && (rest == "" || rest[0] == filepath.Separator) {
+		return "~" + rest
+	}
+	return path
+}
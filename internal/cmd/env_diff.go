@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/direnv/direnv/v2/gzenv"
 )
 
-// IgnoredKeys is list of keys we don't want to deal with
+// IgnoredKeys is list of keys we don't want to deal with. It is the default,
+// the [diff] ignore option extends a copy of it in the EnvDiffOptions.
 var IgnoredKeys = map[string]bool{
 	// direnv env config
 	"DIRENV_CONFIG": true,
@@ -27,20 +30,100 @@ var IgnoredKeys = map[string]bool{
 	"_":         true,
 }
 
+// IgnoredPrefixes is the list of key prefixes we don't want to deal with
+var IgnoredPrefixes = []string{
+	"__fish",
+	"BASH_FUNC_",
+}
+
+// ListKeys is the list of variables holding a list of paths, whose changes
+// are also recorded element by element.
+var ListKeys = map[string]bool{
+	"PATH":       true,
+	"MANPATH":    true,
+	"PYTHONPATH": true,
+}
+
+// EnvDiffOptions selects the variables left out of the diffs and the ones
+// whose changes are recorded element by element.
+type EnvDiffOptions struct {
+	IgnoredKeys     map[string]bool
+	IgnoredPrefixes []string
+	ListKeys        map[string]bool
+}
+
+// defaultEnvDiffOptions are the options of BuildEnvDiff and IgnoredEnv.
+var defaultEnvDiffOptions = &EnvDiffOptions{IgnoredKeys, IgnoredPrefixes, ListKeys}
+
+// DefaultEnvDiffOptions returns a copy of the default options, that can be
+// extended.
+func DefaultEnvDiffOptions() *EnvDiffOptions {
+	opts := &EnvDiffOptions{
+		IgnoredKeys:     make(map[string]bool, len(IgnoredKeys)),
+		IgnoredPrefixes: append([]string(nil), IgnoredPrefixes...),
+		ListKeys:        make(map[string]bool, len(ListKeys)),
+	}
+	for key := range IgnoredKeys {
+		opts.IgnoredKeys[key] = true
+	}
+	for key := range ListKeys {
+		opts.ListKeys[key] = true
+	}
+	return opts
+}
+
+// Ignored returns true if the key should be ignored in environment diffs.
+func (opts *EnvDiffOptions) Ignored(key string) bool {
+	if opts == nil {
+		opts = defaultEnvDiffOptions
+	}
+	for _, prefix := range opts.IgnoredPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return opts.IgnoredKeys[key]
+}
+
+// What to do on unload with the variables changed by hand since the RC was
+// loaded, see the on_drift option.
+const (
+	DriftKeep   = "keep"
+	DriftWarn   = "warn"
+	DriftRevert = "revert"
+)
+
 // EnvDiff represents the diff between two environments
 type EnvDiff struct {
 	Prev map[string]string `json:"p"`
 	Next map[string]string `json:"n"`
+	// Lists holds the element-level changes of the ListKeys
+	Lists map[string]*ListDiff `json:"l,omitempty"`
+}
+
+// ListDiff is the element-level change of a list variable, eg: PATH.
+type ListDiff struct {
+	Added   []string `json:"a,omitempty"`
+	Removed []string `json:"r,omitempty"`
 }
 
 // NewEnvDiff is an empty constructor for EnvDiff
 func NewEnvDiff() *EnvDiff {
-	return &EnvDiff{make(map[string]string), make(map[string]string)}
+	return &EnvDiff{Prev: make(map[string]string), Next: make(map[string]string)}
 }
 
 // BuildEnvDiff analyses the changes between 'e1' and 'e2' and builds an
 // EnvDiff out of it.
 func BuildEnvDiff(e1, e2 Env) *EnvDiff {
+	return BuildEnvDiffWith(e1, e2, nil)
+}
+
+// BuildEnvDiffWith is like BuildEnvDiff, with the given options instead of
+// the default ones when not nil.
+func BuildEnvDiffWith(e1, e2 Env, opts *EnvDiffOptions) *EnvDiff {
+	if opts == nil {
+		opts = defaultEnvDiffOptions
+	}
 	diff := NewEnvDiff()
 
 	in := func(key string, e Env) bool {
@@ -49,7 +132,7 @@ func BuildEnvDiff(e1, e2 Env) *EnvDiff {
 	}
 
 	for key := range e1 {
-		if IgnoredEnv(key) {
+		if opts.Ignored(key) {
 			continue
 		}
 		if e2[key] != e1[key] || !in(key, e2) {
@@ -58,7 +141,7 @@ func BuildEnvDiff(e1, e2 Env) *EnvDiff {
 	}
 
 	for key := range e2 {
-		if IgnoredEnv(key) {
+		if opts.Ignored(key) {
 			continue
 		}
 		if e2[key] != e1[key] || !in(key, e1) {
@@ -66,6 +149,21 @@ func BuildEnvDiff(e1, e2 Env) *EnvDiff {
 		}
 	}
 
+	for key := range opts.ListKeys {
+		prev, inPrev := diff.Prev[key]
+		next, inNext := diff.Next[key]
+		if !inPrev && !inNext {
+			continue
+		}
+		if diff.Lists == nil {
+			diff.Lists = make(map[string]*ListDiff)
+		}
+		diff.Lists[key] = &ListDiff{
+			Added:   subtractList(splitList(next), splitList(prev)),
+			Removed: subtractList(splitList(prev), splitList(next)),
+		}
+	}
+
 	return diff
 }
 
@@ -103,6 +201,9 @@ func (diff *EnvDiff) ToShell(shell Shell) (string, error) {
 
 // Patch applies the diff to the given env and returns a new env with the
 // changes applied.
+//
+// The list variables that were modified since the diff was made only get
+// their elements added and removed, so the other changes are kept.
 func (diff *EnvDiff) Patch(env Env) (newEnv Env) {
 	newEnv = make(Env)
 
@@ -118,12 +219,92 @@ func (diff *EnvDiff) Patch(env Env) (newEnv Env) {
 		newEnv[key] = value
 	}
 
+	for key, list := range diff.Lists {
+		current, ok := env[key]
+		if !ok || current == diff.Prev[key] {
+			continue
+		}
+		elements := list.Patch(splitList(current), splitList(diff.Next[key]))
+		if _, inNext := diff.Next[key]; !inNext && len(elements) == 0 {
+			delete(newEnv, key)
+		} else {
+			newEnv[key] = strings.Join(elements, string(os.PathListSeparator))
+		}
+	}
+
 	return newEnv
 }
 
+// Drifted returns the sorted keys whose value in env isn't the one the diff
+// applied anymore, eg: a variable exported by hand after loading the RC.
+//
+// The list variables are left out, their elements are merged on unload.
+func (diff *EnvDiff) Drifted(env Env) []string {
+	var keys []string
+	check := func(key string) {
+		if direnvKey(key) || diff.Lists[key] != nil {
+			return
+		}
+		next, inNext := diff.Next[key]
+		current, inEnv := env[key]
+		if inNext != inEnv || current != next {
+			keys = append(keys, key)
+		}
+	}
+	for key := range diff.Next {
+		check(key)
+	}
+	for key := range diff.Prev {
+		if _, ok := diff.Next[key]; !ok {
+			check(key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Reverse flips the diff so that it applies the other way around.
 func (diff *EnvDiff) Reverse() *EnvDiff {
-	return &EnvDiff{diff.Next, diff.Prev}
+	reversed := &EnvDiff{Prev: diff.Next, Next: diff.Prev}
+	for key, list := range diff.Lists {
+		if reversed.Lists == nil {
+			reversed.Lists = make(map[string]*ListDiff)
+		}
+		reversed.Lists[key] = &ListDiff{Added: list.Removed, Removed: list.Added}
+	}
+	return reversed
+}
+
+// Patch removes the removed elements from the list and inserts the added
+// ones next to their neighbours in target.
+func (list *ListDiff) Patch(elements, target []string) []string {
+	elements = subtractList(elements, list.Removed)
+	for _, element := range list.Added {
+		i := insertIndex(elements, target, element)
+		elements = append(elements[:i], append([]string{element}, elements[i:]...)...)
+	}
+	return elements
+}
+
+// insertIndex returns where element goes in elements: after the closest
+// element that precedes it in target, or else before the closest one that
+// follows it, or else at the end.
+func insertIndex(elements, target []string, element string) int {
+	t := indexOf(target, element)
+	if t < 0 {
+		return len(elements)
+	}
+	for j := t - 1; j >= 0; j-- {
+		if i := indexOf(elements, target[j]); i >= 0 {
+			return i + 1
+		}
+	}
+	for j := t + 1; j < len(target); j++ {
+		if i := indexOf(elements, target[j]); i >= 0 {
+			return i
+		}
+	}
+	return len(elements)
 }
 
 // Serialize marshalls the environment diff to the gzenv format.
@@ -133,14 +314,42 @@ func (diff *EnvDiff) Serialize() string {
 
 //// Utils
 
-// IgnoredEnv returns true if the key should be ignored in environment diffs.
-func IgnoredEnv(key string) bool {
-	if strings.HasPrefix(key, "__fish") {
-		return true
+// splitList splits the value of a list variable into its elements.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
 	}
-	if strings.HasPrefix(key, "BASH_FUNC_") {
-		return true
+	return strings.Split(value, string(os.PathListSeparator))
+}
+
+// subtractList returns a without one occurrence of each element of b.
+func subtractList(a, b []string) []string {
+	count := make(map[string]int)
+	for _, element := range b {
+		count[element]++
 	}
-	_, found := IgnoredKeys[key]
-	return found
+	var out []string
+	for _, element := range a {
+		if count[element] > 0 {
+			count[element]--
+			continue
+		}
+		out = append(out, element)
+	}
+	return out
+}
+
+func indexOf(list []string, element string) int {
+	for i, e := range list {
+		if e == element {
+			return i
+		}
+	}
+	return -1
+}
+
+// IgnoredEnv returns true if the key should be ignored in environment diffs,
+// with the default options.
+func IgnoredEnv(key string) bool {
+	return defaultEnvDiffOptions.Ignored(key)
 }
@@ -6,7 +6,7 @@ import (
 )
 
 func TestEnvDiff(t *testing.T) {
-	diff := &EnvDiff{map[string]string{"FOO": "bar"}, map[string]string{"BAR": "baz"}}
+	diff := &EnvDiff{Prev: map[string]string{"FOO": "bar"}, Next: map[string]string{"BAR": "baz"}}
 
 	out := diff.Serialize()
 
@@ -54,3 +54,65 @@ func TestIgnoredEnv(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEnvDiffListKeys(t *testing.T) {
+	before := Env{"PATH": "/usr/bin:/bin", "FOO": "a"}
+	loaded := Env{"PATH": "/proj/bin:/usr/bin:/bin", "FOO": "b", "PYTHONPATH": "/proj/lib"}
+
+	diff := BuildEnvDiff(before, loaded)
+	if list := diff.Lists["PATH"]; list == nil || !reflect.DeepEqual(list.Added, []string{"/proj/bin"}) || len(list.Removed) != 0 {
+		t.Fatalf("unexpected PATH list diff %#v", list)
+	}
+
+	diff2, err := LoadEnvDiff(diff.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unmodified, the previous values are restored exactly
+	if reverted := diff2.Reverse().Patch(loaded); !reflect.DeepEqual(reverted, before) {
+		t.Errorf("expected %v, got %v", before, reverted)
+	}
+
+	// The elements added by the user are kept
+	modified := loaded.Copy()
+	modified["PATH"] = "/proj/bin:/usr/bin:/bin:/foo"
+	modified["PYTHONPATH"] = "/proj/lib:/mine"
+	reverted := diff2.Reverse().Patch(modified)
+	if reverted["PATH"] != "/usr/bin:/bin:/foo" {
+		t.Errorf("PATH = %q, expected the user addition to be kept", reverted["PATH"])
+	}
+	if reverted["PYTHONPATH"] != "/mine" {
+		t.Errorf("PYTHONPATH = %q, expected the user addition to be kept", reverted["PYTHONPATH"])
+	}
+	if reverted["FOO"] != "a" {
+		t.Errorf("FOO = %q, expected it to be restored", reverted["FOO"])
+	}
+
+	// Elements removed by the RC are put back at their place
+	removed := BuildEnvDiff(Env{"PATH": "/a:/b:/c"}, Env{"PATH": "/a:/c"})
+	if reverted := removed.Reverse().Patch(Env{"PATH": "/x:/a:/c"}); reverted["PATH"] != "/x:/a:/b:/c" {
+		t.Errorf("PATH = %q, expected /b to be put back", reverted["PATH"])
+	}
+}
+
+func TestEnvDiffDrifted(t *testing.T) {
+	before := Env{"PATH": "/usr/bin", "AWS_PROFILE": "default", "GONE": "x"}
+	loaded := Env{"PATH": "/proj/bin:/usr/bin", "AWS_PROFILE": "dev", "FOO": "1", DIRENV_DIR: "-/proj"}
+	diff := BuildEnvDiff(before, loaded)
+
+	if drifted := diff.Drifted(loaded); len(drifted) != 0 {
+		t.Errorf("expected no drift, got %v", drifted)
+	}
+
+	modified := loaded.Copy()
+	modified["AWS_PROFILE"] = "other"
+	modified["PATH"] = "/foo:/proj/bin:/usr/bin"
+	modified["GONE"] = "y"
+	delete(modified, "FOO")
+	delete(modified, DIRENV_DIR)
+	expected := []string{"AWS_PROFILE", "FOO", "GONE"}
+	if drifted := diff.Drifted(modified); !reflect.DeepEqual(drifted, expected) {
+		t.Errorf("expected %v, got %v", expected, drifted)
+	}
+}
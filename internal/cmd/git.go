@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" // #nosec G505 -- git object ids are SHA-1 based
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitRepo is the minimal information direnv needs about a git checkout. It's
+// read straight from the .git folder so that direnv doesn't depend on git
+// being installed.
+type gitRepo struct {
+	workTree  string // top-level directory of the checkout
+	gitDir    string // holds the index and HEAD
+	commonDir string // holds the config, shared between worktrees
+}
+
+// findGitRepo looks for the git checkout enclosing dir.
+func findGitRepo(dir string) *gitRepo {
+	for _, d := range eachDir(dir) {
+		dotGit := filepath.Join(d, ".git")
+		fi, err := os.Stat(dotGit)
+		if err != nil {
+			continue
+		}
+
+		repo := &gitRepo{workTree: d, gitDir: dotGit}
+		if !fi.IsDir() {
+			// worktrees and submodules use a "gitdir: <path>" file
+			content, err := os.ReadFile(dotGit)
+			if err != nil {
+				return nil
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+			if !ok {
+				return nil
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(d, gitDir)
+			}
+			repo.gitDir = gitDir
+		}
+
+		repo.commonDir = repo.gitDir
+		if content, err := os.ReadFile(filepath.Join(repo.gitDir, "commondir")); err == nil {
+			commonDir := strings.TrimSpace(string(content))
+			if !filepath.IsAbs(commonDir) {
+				commonDir = filepath.Join(repo.gitDir, commonDir)
+			}
+			repo.commonDir = commonDir
+		}
+		return repo
+	}
+	return nil
+}
+
+// config returns the value of the given key in the repository config, the
+// last one if it is set several times like git does. The section is the part
+// in brackets, eg: `remote "origin"`.
+func (repo *gitRepo) config(section, key string) (string, error) {
+	values, err := repo.configValues(section, key)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return values[len(values)-1], nil
+}
+
+// configValues returns all the values of the given key in the repository
+// config, in order. Section names and keys are case-insensitive, the
+// subsections in quotes are not.
+func (repo *gitRepo) configValues(section, key string) ([]string, error) {
+	f, err := os.Open(filepath.Join(repo.commonDir, "config"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var inSection bool
+	var values []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			header, rest, _ := strings.Cut(line[1:], "]")
+			inSection = gitSectionMatch(header, section)
+			// a key can follow the header on the same line
+			if line = strings.TrimSpace(rest); line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		}
+		if !inSection {
+			continue
+		}
+		k, v, _ := strings.Cut(line, "=")
+		if strings.EqualFold(strings.TrimSpace(k), key) {
+			values = append(values, gitConfigValue(v))
+		}
+	}
+	return values, scanner.Err()
+}
+
+// gitSectionMatch returns true if the section header, eg: `remote "origin"`,
+// is the given section.
+func gitSectionMatch(header, section string) bool {
+	name, sub, _ := strings.Cut(strings.TrimSpace(header), " ")
+	wantName, wantSub, _ := strings.Cut(section, " ")
+	return strings.EqualFold(name, wantName) && strings.TrimSpace(sub) == wantSub
+}
+
+// gitConfigValue unquotes a value of the config and strips its trailing
+// comment.
+func gitConfigValue(raw string) string {
+	var value strings.Builder
+	var quoted, escaped bool
+	for _, c := range strings.TrimSpace(raw) {
+		switch {
+		case escaped:
+			switch c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			}
+			value.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteRune(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
+
+// remoteURL returns the URL of the given remote, or an empty string. Like
+// git fetch, the first one is used when several are set.
+func (repo *gitRepo) remoteURL(name string) (string, error) {
+	values, err := repo.configValues(`remote "`+name+`"`, "url")
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return values[0], nil
+}
+
+// newObjectHash returns the hash used for object ids in the repository.
+func (repo *gitRepo) newObjectHash() (hash.Hash, error) {
+	format, err := repo.config("extensions", "objectformat")
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(format) {
+	case "", "sha1":
+		return sha1.New(), nil // #nosec G401
+	case "sha256":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported git object format %q", format)
+	}
+}
+
+// isUnmodified returns true if the file at path is tracked in the index and
+// its content matches the staged version.
+func (repo *gitRepo) isUnmodified(filePath string) (bool, error) {
+	relPath, err := filepath.Rel(repo.workTree, filePath)
+	if err != nil {
+		return false, err
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	h, err := repo.newObjectHash()
+	if err != nil {
+		return false, err
+	}
+
+	oid, err := readGitIndexEntry(filepath.Join(repo.gitDir, "index"), relPath, h.Size())
+	if err != nil || oid == nil {
+		return false, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	_, _ = fmt.Fprintf(h, "blob %d\x00", len(content))
+	_, _ = h.Write(content)
+
+	return bytes.Equal(h.Sum(nil), oid), nil
+}
+
+// readGitIndexEntry looks for relPath in the git index and returns its object
+// id, or nil if the file is not tracked.
+//
+// See https://git-scm.com/docs/index-format
+func readGitIndexEntry(indexPath, relPath string, oidSize int) ([]byte, error) {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, errors.New("invalid git index")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	const statSize = 40 // ctime, mtime, dev, ino, mode, uid, gid, size
+	offset := 12
+	var prevName string
+	for i := uint32(0); i < count; i++ {
+		start := offset
+		if offset+statSize+oidSize+2 > len(data) {
+			return nil, errors.New("truncated git index")
+		}
+		oid := data[offset+statSize : offset+statSize+oidSize]
+		offset += statSize + oidSize
+		flags := binary.BigEndian.Uint16(data[offset:])
+		offset += 2
+		if version >= 3 && flags&0x4000 != 0 {
+			offset += 2
+		}
+
+		var name string
+		if version == 4 {
+			// the name is prefix-compressed against the previous entry
+			strip, n := gitIndexVarint(data[offset:])
+			if n == 0 || strip > len(prevName) {
+				return nil, errors.New("invalid git index entry")
+			}
+			offset += n
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("truncated git index")
+			}
+			name = prevName[:len(prevName)-strip] + string(data[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("truncated git index")
+			}
+			name = string(data[offset : offset+end])
+			// entries are padded with NULs to a multiple of 8 bytes
+			offset = start + (offset-start+end+8)&^7
+		}
+		prevName = name
+
+		stage := (flags >> 12) & 0x3
+		if stage == 0 && name == relPath {
+			return oid, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// gitIndexVarint decodes the offset encoding used by the v4 index format.
+func gitIndexVarint(data []byte) (value int, n int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	n = 1
+	value = int(c & 0x7f)
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		value = ((value + 1) << 7) | int(c&0x7f)
+	}
+	return value, n
+}
+
+// gitRemoteTrusted returns true if the RC file is tracked and unmodified in
+// a git checkout whose origin matches one of the given patterns.
+func gitRemoteTrusted(rcPath string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	repo := findGitRepo(filepath.Dir(rcPath))
+	if repo == nil {
+		return false
+	}
+
+	url, err := repo.remoteURL("origin")
+	if err != nil || url == "" {
+		logDebug("git trust: no origin for %s: %v", repo.workTree, err)
+		return false
+	}
+	if !matchGitRemote(url, patterns) {
+		logDebug("git trust: origin %s doesn't match", url)
+		return false
+	}
+
+	ok, err := repo.isUnmodified(rcPath)
+	if err != nil {
+		logDebug("git trust: %v", err)
+	}
+	return ok
+}
+
+func matchGitRemote(url string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, candidate := range []string{url, strings.TrimSuffix(url, ".git")} {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
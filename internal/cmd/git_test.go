@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitRemoteTrusted(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	for _, indexVersion := range []string{"2", "4"} {
+		dir := t.TempDir()
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-C", dir, "-c", "index.version=" + indexVersion}, args...)...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v\n%s", args, err, out)
+			}
+		}
+		rcPath := filepath.Join(dir, "sub", ".envrc")
+		if err := os.MkdirAll(filepath.Dir(rcPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a", "sub/b", "sub/.envrc", "zzz"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("export FOO="+name+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		git("init", "-q")
+		git("remote", "add", "origin", "git@github.com:myorg/repo.git")
+		git("add", ".")
+
+		if !gitRemoteTrusted(rcPath, []string{"git@github.com:myorg/*"}) {
+			t.Errorf("index v%s: expected tracked .envrc to be trusted", indexVersion)
+		}
+		if gitRemoteTrusted(rcPath, []string{"git@github.com:otherorg/*"}) {
+			t.Errorf("index v%s: expected .envrc from another remote not to be trusted", indexVersion)
+		}
+
+		if err := os.WriteFile(rcPath, []byte("echo modified\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if gitRemoteTrusted(rcPath, []string{"git@github.com:myorg/*"}) {
+			t.Errorf("index v%s: expected modified .envrc not to be trusted", indexVersion)
+		}
+	}
+}
+
+func TestGitConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := `[core]
+	repositoryformatversion = 0
+[Remote "Origin"]
+	url = git@github.com:evil/repo.git
+[remote "origin"]
+	url = "git@github.com:myorg/repo.git" # the main one
+	url = git@github.com:mirror/repo.git ; a mirror
+[Extensions]
+	objectFormat = sha256
+`
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo := &gitRepo{workTree: dir, gitDir: dir, commonDir: dir}
+
+	url, err := repo.remoteURL("origin")
+	if err != nil || url != "git@github.com:myorg/repo.git" {
+		t.Errorf("unexpected url %q: %v", url, err)
+	}
+	if format, _ := repo.config("extensions", "objectformat"); format != "sha256" {
+		t.Errorf("unexpected objectformat %q", format)
+	}
+}
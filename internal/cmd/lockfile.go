@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockfileName is the default name of the lockfile, next to the RC file.
+const LockfileName = "direnv.lock"
+
+// Placeholders substituted in the lockfile values, so that it doesn't depend
+// on the machine.
+const (
+	lockProjectRoot = "${PROJECT_ROOT}"
+	lockHome        = "${HOME}"
+)
+
+// Lockfile records the variables set and unset by an RC file, as written by
+// `direnv freeze` and checked by `direnv verify`.
+type Lockfile struct {
+	Version int               `json:"version"`
+	Env     map[string]string `json:"env"`
+	Unset   []string          `json:"unset,omitempty"`
+}
+
+// NewLockfile builds the lockfile of the changes from previousEnv to newEnv,
+// made by the RC file in root. opts are the diff options, nil for the
+// default ones.
+//
+// The values are normalized: the previous value of a variable is replaced by
+// a reference to it (eg: "${PATH}" for a PATH_add), then the project root
+// and the home directory by placeholders. As the lockfile is meant to be
+// committed, the values of the variables that look like secrets are masked,
+// like in `direnv diff`.
+func NewLockfile(root string, previousEnv, newEnv Env, opts *EnvDiffOptions) *Lockfile {
+	lock := &Lockfile{Version: 1, Env: make(map[string]string)}
+	diff := BuildEnvDiffWith(previousEnv, newEnv, opts)
+	home := previousEnv["HOME"]
+
+	for key, value := range diff.Next {
+		if direnvKey(key) {
+			continue
+		}
+		if secretKeyRe.MatchString(key) {
+			lock.Env[key] = maskedValue
+			continue
+		}
+		value = replacePrevious(key, value, previousEnv[key])
+		value = replacePathPrefix(value, root, lockProjectRoot)
+		if home != "" {
+			value = replacePathPrefix(value, home, lockHome)
+		}
+		lock.Env[key] = value
+	}
+	for key := range diff.Prev {
+		if _, ok := diff.Next[key]; !ok && !direnvKey(key) {
+			lock.Unset = append(lock.Unset, key)
+		}
+	}
+	sort.Strings(lock.Unset)
+	return lock
+}
+
+// replacePrevious replaces prev by a reference to key if value is prev with
+// elements added at the start or the end of the list.
+func replacePrevious(key, value, prev string) string {
+	if prev == "" {
+		return value
+	}
+	ref := "${" + key + "}"
+	sep := string(os.PathListSeparator)
+	switch {
+	case value == prev:
+		return ref
+	case strings.HasSuffix(value, sep+prev):
+		return strings.TrimSuffix(value, prev) + ref
+	case strings.HasPrefix(value, prev+sep):
+		return ref + strings.TrimPrefix(value, prev)
+	}
+	if i := strings.Index(value, sep+prev+sep); i >= 0 {
+		return value[:i+1] + ref + value[i+1+len(prev):]
+	}
+	return value
+}
+
+// replacePathPrefix replaces dir by placeholder, wherever it starts a path.
+func replacePathPrefix(value, dir, placeholder string) string {
+	if dir == "" || dir == string(filepath.Separator) {
+		return value
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(value, dir)
+		if i < 0 {
+			b.WriteString(value)
+			return b.String()
+		}
+		rest := value[i+len(dir):]
+		if rest == "" || rest[0] == filepath.Separator || rest[0] == os.PathListSeparator {
+			b.WriteString(value[:i])
+			b.WriteString(placeholder)
+		} else {
+			b.WriteString(value[:i+len(dir)])
+		}
+		value = rest
+	}
+}
+
+// LoadLockfile reads the lockfile at path.
+func LoadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := new(Lockfile)
+	if err = json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	if lock.Version != 1 {
+		return nil, fmt.Errorf("unsupported lockfile version %d in %s", lock.Version, path)
+	}
+	return lock, nil
+}
+
+// Write stores the lockfile at path.
+func (lock *Lockfile) Write(path string) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	// G306: Expect WriteFile permissions to be 0600 or less
+	// #nosec
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// lines renders the lockfile as sorted KEY=value lines, for diffing.
+func (lock *Lockfile) lines() []byte {
+	var lines []string
+	for key, value := range lock.Env {
+		lines = append(lines, key+"="+value)
+	}
+	for _, key := range lock.Unset {
+		lines = append(lines, "unset "+key)
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// freezeRC evaluates the RC file from the environment without any direnv
+// changes, and returns its lockfile. The RC must be allowed: a blocked one
+// would otherwise give an empty lockfile.
+func freezeRC(rc *RC, env Env, config *Config) (*Lockfile, error) {
+	switch rc.Allowed() {
+	case NotAllowed:
+		return nil, rc.notAllowedError()
+	case Denied:
+		return nil, fmt.Errorf("%s is denied. Run `direnv allow` to approve its content", rc.Path())
+	}
+
+	previousEnv, err := config.Revert(env)
+	if err != nil {
+		return nil, err
+	}
+	previousEnv.CleanContext()
+
+	// Always evaluate, the cache doesn't know about toolchain updates. The
+	// environment isn't exported to a shell, no state to keep.
+	config.CacheEnv = false
+	config.PrivateState = false
+	newEnv, err := rc.Load(previousEnv)
+	if err != nil {
+		return nil, err
+	}
+	return NewLockfile(filepath.Dir(rc.Path()), previousEnv, newEnv, config.DiffOptions), nil
+}
+
+// parseLockfileArgs parses `[--lockfile PATH] [PATH_TO_RC]`.
+func parseLockfileArgs(args []string, config *Config) (rc *RC, lockPath string, err error) {
+	var rcPath string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--lockfile" {
+			if rcPath != "" {
+				return nil, "", fmt.Errorf("unexpected argument %q", args[i])
+			}
+			rcPath = args[i]
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("--lockfile requires an argument")
+			}
+			i++
+			value = args[i]
+		}
+		lockPath = value
+	}
+
+	if rc, err = findRCArg(rcPath, config); err != nil {
+		return nil, "", err
+	}
+	if lockPath == "" {
+		lockPath = filepath.Join(filepath.Dir(rc.Path()), LockfileName)
+	}
+	return rc, lockPath, nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewLockfile(t *testing.T) {
+	previousEnv := Env{
+		"HOME":  "/home/alice",
+		"PATH":  "/usr/bin:/bin",
+		"LANG":  "C",
+		"SHELL": "/bin/bash",
+	}
+	newEnv := Env{
+		"HOME":           "/home/alice",
+		"PATH":           "/home/alice/src/app/bin:/usr/bin:/bin",
+		"SHELL":          "/bin/zsh",
+		"CACHE":          "/home/alice/.cache/app",
+		"ROOT":           "/home/alice/src/app",
+		"OTHER":          "/home/alice/src/application",
+		DIRENV_WATCHES:   "ignored",
+		"GOFLAGS":        "-mod=mod",
+		"MANPATH_SUFFIX": "x",
+		"API_TOKEN":      "s3cr3t",
+	}
+
+	lock := NewLockfile("/home/alice/src/app", previousEnv, newEnv, nil)
+	for key, expected := range map[string]string{
+		"PATH":           "${PROJECT_ROOT}/bin:${PATH}",
+		"CACHE":          "${HOME}/.cache/app",
+		"ROOT":           "${PROJECT_ROOT}",
+		"OTHER":          "${HOME}/src/application",
+		"GOFLAGS":        "-mod=mod",
+		"MANPATH_SUFFIX": "x",
+		"API_TOKEN":      maskedValue,
+	} {
+		if lock.Env[key] != expected {
+			t.Errorf("%s = %q, expected %q", key, lock.Env[key], expected)
+		}
+	}
+	if _, ok := lock.Env[DIRENV_WATCHES]; ok {
+		t.Error("expected the direnv variables to be left out")
+	}
+	if _, ok := lock.Env["SHELL"]; ok {
+		t.Error("expected the ignored variables to be left out")
+	}
+	if len(lock.Unset) != 1 || lock.Unset[0] != "LANG" {
+		t.Errorf("expected LANG to be unset, got %v", lock.Unset)
+	}
+}
+
+func TestReplacePrevious(t *testing.T) {
+	for _, c := range [][3]string{
+		{"/a:/usr/bin", "/usr/bin", "/a:${PATH}"},
+		{"/usr/bin:/z", "/usr/bin", "${PATH}:/z"},
+		{"/a:/usr/bin:/z", "/usr/bin", "/a:${PATH}:/z"},
+		{"/usr/bin", "/usr/bin", "${PATH}"},
+		{"/usr/bin2", "/usr/bin", "/usr/bin2"},
+	} {
+		if actual := replacePrevious("PATH", c[0], c[1]); actual != c[2] {
+			t.Errorf("replacePrevious(%q, %q) = %q, expected %q", c[0], c[1], actual, c[2])
+		}
+	}
+}
+
+func TestFreezeRequiresAllowed(t *testing.T) {
+	rcPath := filepath.Join(t.TempDir(), ".envrc.toml")
+	if err := os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{DataDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = freezeRC(rc, Env{}, config); err == nil {
+		t.Error("expected a blocked RC not to be frozen")
+	}
+	if err = rc.Deny(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = freezeRC(rc, Env{}, config); err == nil {
+		t.Error("expected a denied RC not to be frozen")
+	}
+
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := freezeRC(rc, Env{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Env["FOO"] != "bar" {
+		t.Errorf("expected FOO in the lockfile, got %v", lock.Env)
+	}
+}
+
+func TestFreezeIgnoresCache(t *testing.T) {
+	rcPath := filepath.Join(t.TempDir(), ".envrc.toml")
+	if err := os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}, CacheEnv: true}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cached result from before a toolchain update, that no watch catches
+	previousEnv, err := config.Revert(Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousEnv.CleanContext()
+	times := NewFileTimes()
+	if err = times.Update(rcPath); err != nil {
+		t.Fatal(err)
+	}
+	rc.storeCachedEnv(previousEnv, Env{"FOO": "stale", DIRENV_WATCHES: times.Marshal()})
+
+	lock, err := freezeRC(rc, Env{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Env["FOO"] != "bar" {
+		t.Errorf("expected the RC to be evaluated again, got FOO=%q", lock.Env["FOO"])
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// interruptSignals cancel the evaluation of the RC files.
+var interruptSignals = []os.Signal{os.Interrupt}
+
+// killProcessGroupOnCancel is not supported on this platform, only the
+// command itself gets killed when its context is canceled.
+func killProcessGroupOnCancel(_ context.Context, cmd *exec.Cmd, grace time.Duration) {
+	cmd.WaitDelay = grace
+}
+
+// detachProcess is not supported on this platform.
+func detachProcess(_ *exec.Cmd) {}
+
+// processAlive returns true if the process with the given pid exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
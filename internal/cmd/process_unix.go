@@ -0,0 +1,52 @@
+//go:build unix
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// interruptSignals cancel the evaluation of the RC files. They are forwarded
+// to the process group of the evaluation, which doesn't get the ones of the
+// terminal.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// killProcessGroupOnCancel runs the command in its own process group and
+// kills the whole group when ctx is canceled, so that the grandchildren
+// don't outlive it. On a timeout, the group is killed right away. Otherwise,
+// eg: on Ctrl-C, it is interrupted first and only killed if still there
+// after grace.
+func killProcessGroupOnCancel(ctx context.Context, cmd *exec.Cmd, grace time.Duration) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return syscall.Kill(pgid, syscall.SIGKILL)
+		}
+		// The group lives on as long as one of its processes does, so its id
+		// can't be reused in the meantime
+		time.AfterFunc(grace, func() { _ = syscall.Kill(pgid, syscall.SIGKILL) })
+		return syscall.Kill(pgid, syscall.SIGINT)
+	}
+	cmd.WaitDelay = grace
+}
+
+// detachProcess starts the command in a new session, so it keeps running
+// when the terminal goes away.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive returns true if the process with the given pid exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
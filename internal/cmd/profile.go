@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ProfileDir is the folder where the active profile of each directory is
+// stored.
+func (config *Config) ProfileDir() string {
+	return filepath.Join(config.DataDir, "profile")
+}
+
+// profilePath returns the file holding the active profile of dir. It is
+// watched so changing the profile triggers a reload.
+func (config *Config) profilePath(dir string) (string, error) {
+	dirHash, err := pathHash(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config.ProfileDir(), dirHash), nil
+}
+
+// Profile returns the active profile of dir, or "" if there is none.
+func (config *Config) Profile(dir string) (string, error) {
+	profilePath, err := config.profilePath(dir)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(profilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	// The first line is the profile, the second one the directory
+	profile, _, _ := strings.Cut(string(data), "\n")
+	return profile, nil
+}
+
+// SetProfile records the active profile of dir. An empty profile removes it.
+func (config *Config) SetProfile(dir, profile string) error {
+	profilePath, err := config.profilePath(dir)
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		err = os.Remove(profilePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !profileNameRe.MatchString(profile) {
+		return fmt.Errorf("invalid profile %q, only letters, digits, - and _ are allowed", profile)
+	}
+	if err = os.MkdirAll(filepath.Dir(profilePath), 0755); err != nil {
+		return err
+	}
+	// G306: Expect WriteFile permissions to be 0600 or less
+	// #nosec
+	return os.WriteFile(profilePath, []byte(profile+"\n"+dir+"\n"), 0644)
+}
+
+// pruneProfiles removes the profiles of the directories that don't exist
+// anymore.
+func pruneProfiles(config *Config) error {
+	profileDir := config.ProfileDir()
+	names, err := readDirNames(profileDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		profilePath := filepath.Join(profileDir, name)
+		data, err := os.ReadFile(profilePath)
+		if err != nil {
+			continue
+		}
+		_, dir, _ := strings.Cut(string(data), "\n")
+		if fi, err := os.Stat(strings.TrimSpace(dir)); err != nil || !fi.IsDir() {
+			_ = os.Remove(profilePath)
+		}
+	}
+	return nil
+}
+
+// profileRCPath returns the variant of the RC file at path for the given
+// profile, eg: .envrc.staging for .envrc or .envrc.staging.toml for
+// .envrc.toml.
+func profileRCPath(path, profile string) string {
+	ext := ""
+	if isTomlRC(path) {
+		ext = ".toml"
+	}
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// isProfileRC returns true if path is an existing profile variant of one of
+// the rc_names, that gets allowed on its own.
+func (config *Config) isProfileRC(path string) bool {
+	base := filepath.Base(path)
+	for _, name := range config.RCNames {
+		if base == name {
+			return false
+		}
+	}
+	for _, name := range config.RCNames {
+		name = strings.TrimSuffix(name, ".toml")
+		if strings.HasPrefix(base, name+".") && profileNameRe.MatchString(strings.TrimSuffix(base[len(name)+1:], ".toml")) {
+			return fileExists(path)
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), RCNames: []string{".envrc", ".envrc.toml"}}
+	dir := t.TempDir()
+
+	if profile, err := config.Profile(dir); err != nil || profile != "" {
+		t.Fatalf("expected no profile, got %q, %v", profile, err)
+	}
+	if err := config.SetProfile(dir, "staging"); err != nil {
+		t.Fatal(err)
+	}
+	if profile, err := config.Profile(dir); err != nil || profile != "staging" {
+		t.Errorf("expected staging, got %q, %v", profile, err)
+	}
+	if err := config.SetProfile(dir, "../prod"); err == nil {
+		t.Error("expected an invalid profile name to be rejected")
+	}
+	if err := config.SetProfile(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if profile, _ := config.Profile(dir); profile != "" {
+		t.Errorf("expected the profile to be removed, got %q", profile)
+	}
+
+	if p := profileRCPath("/src/.envrc.toml", "staging"); p != "/src/.envrc.staging.toml" {
+		t.Errorf("unexpected profile variant %s", p)
+	}
+
+	for name, expected := range map[string]bool{
+		".envrc":              false,
+		".envrc.toml":         false,
+		".envrc.staging":      true,
+		".envrc.staging.toml": true,
+		".envrc.missing":      false,
+	} {
+		path := filepath.Join(dir, name)
+		if name != ".envrc.missing" {
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if actual := config.isProfileRC(path); actual != expected {
+			t.Errorf("isProfileRC(%s) = %v, expected %v", name, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Provenance records, for each variable, the changes made to it while
+// loading an RC file and the calls that made them, in order.
+type Provenance map[string][]*ProvenanceChange
+
+// ProvenanceChange is a change of a variable by a stack of calls.
+type ProvenanceChange struct {
+	// Calls is the stack of calls that made the change, from the outermost
+	// one, eg: "source_env /project/.envrc", "use nix".
+	Calls []string
+	Old   *string
+	New   *string
+}
+
+// provenanceConfig is the call the changes made by the direnvrc and the
+// direnv libraries are attributed to.
+const provenanceConfig = "direnvrc"
+
+// record adds the changes from before to after, made by calls. opts are the
+// diff options of the config.
+func (p Provenance) record(opts *EnvDiffOptions, calls []string, before, after Env) {
+	if len(calls) == 0 {
+		calls = []string{provenanceConfig}
+	}
+	calls = append([]string(nil), calls...)
+
+	diff := BuildEnvDiffWith(before, after, opts)
+	add := func(key string) {
+		if direnvKey(key) {
+			return
+		}
+		change := &ProvenanceChange{Calls: calls}
+		if value, ok := diff.Prev[key]; ok {
+			change.Old = &value
+		}
+		if value, ok := diff.Next[key]; ok {
+			change.New = &value
+		}
+		p[key] = append(p[key], change)
+	}
+	for key := range diff.Next {
+		add(key)
+	}
+	for key := range diff.Prev {
+		if _, ok := diff.Next[key]; !ok {
+			add(key)
+		}
+	}
+}
+
+// recordSnapshots attributes the changes from env to newEnv to the calls
+// that made them, using the snapshots that the stdlib wrote to
+// DIRENV_PROVENANCE_FILE on the entry and exit of each call.
+func (p Provenance) recordSnapshots(opts *EnvDiffOptions, snapshots []byte, env, newEnv Env) error {
+	var stack []string
+	prev := env
+	dec := json.NewDecoder(bytes.NewReader(snapshots))
+	for {
+		var snapshot Env
+		if err := dec.Decode(&snapshot); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		event, call := snapshot[DIRENV_PROVENANCE_EVENT], snapshot[DIRENV_PROVENANCE_CALL]
+		delete(snapshot, DIRENV_PROVENANCE_EVENT)
+		delete(snapshot, DIRENV_PROVENANCE_CALL)
+
+		p.record(opts, stack, prev, snapshot)
+		switch {
+		case event == "enter":
+			stack = append(stack, call)
+		case len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		}
+		prev = snapshot
+	}
+	p.record(opts, stack, prev, newEnv)
+	return nil
+}
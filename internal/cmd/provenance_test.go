@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProvenanceSnapshots(t *testing.T) {
+	env := Env{"HOME": "/home/user"}
+	snapshots := `{"DIRENV_PROVENANCE_EVENT":"enter","DIRENV_PROVENANCE_CALL":"source_env /p/.envrc","HOME":"/home/user","LIB":"1"}
+{"DIRENV_PROVENANCE_EVENT":"enter","DIRENV_PROVENANCE_CALL":"use nix","HOME":"/home/user","LIB":"1","FOO":"a"}
+{"DIRENV_PROVENANCE_EVENT":"exit","HOME":"/home/user","LIB":"1","FOO":"b","DIRENV_DIR":"-/p"}
+`
+	newEnv := Env{"HOME": "/home/user", "LIB": "1", "FOO": "c"}
+
+	p := make(Provenance)
+	if err := p.recordSnapshots(nil, []byte(snapshots), env, newEnv); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls [][]string
+	var values []string
+	for _, change := range p["FOO"] {
+		calls = append(calls, change.Calls)
+		values = append(values, *change.New)
+	}
+	expectedCalls := [][]string{
+		{"source_env /p/.envrc"},
+		{"source_env /p/.envrc", "use nix"},
+		{"source_env /p/.envrc"},
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) || !reflect.DeepEqual(values, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected FOO changes %v %v", calls, values)
+	}
+	if len(p["LIB"]) != 1 || p["LIB"][0].Calls[0] != provenanceConfig {
+		t.Errorf("expected LIB to be set by the %s", provenanceConfig)
+	}
+	if _, ok := p[DIRENV_DIR]; ok {
+		t.Error("expected the direnv variables to be left out")
+	}
+}
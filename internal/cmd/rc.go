@@ -25,9 +25,15 @@ type RC struct {
 	config    *Config
 }
 
-// FindRC looks for ".envrc" and ".env" files up in the file hierarchy.
+// FindRC looks for the rc_names files, ".envrc" and ".env" by default, up in
+// the file hierarchy.
 func FindRC(wd string, config *Config) (*RC, error) {
-	rcPath := findEnvUp(wd, config.LoadDotenv)
+	// A profile variant, eg: .envrc.staging, is allowed on its own
+	if config.isProfileRC(wd) {
+		return RCFromPath(wd, config)
+	}
+
+	rcPath := findEnvUp(wd, config.RCNames)
 	if rcPath == "" {
 		return nil, nil
 	}
@@ -37,7 +43,7 @@ func FindRC(wd string, config *Config) (*RC, error) {
 
 // RCFromPath inits the RC from a given path
 func RCFromPath(path string, config *Config) (*RC, error) {
-	fileHash, err := fileHash(path)
+	fileHash, err := rcHash(path, config)
 	if err != nil {
 		return nil, err
 	}
@@ -68,12 +74,19 @@ func RCFromPath(path string, config *Config) (*RC, error) {
 		return nil, err
 	}
 
+	// Also watch the layers that don't exist yet, to pick them up once created
+	for _, layerPath := range config.layerCandidates(path) {
+		if err = times.Update(layerPath); err != nil {
+			return nil, err
+		}
+	}
+
 	return &RC{path, allowPath, denyPath, times, config}, nil
 }
 
 // RCFromEnv inits the RC from the environment
 func RCFromEnv(path, marshalledTimes string, config *Config) *RC {
-	fileHash, err := fileHash(path)
+	fileHash, err := rcHash(path, config)
 	if err != nil {
 		return nil
 	}
@@ -98,15 +111,31 @@ func RCFromEnv(path, marshalledTimes string, config *Config) *RC {
 
 // Allow grants the RC as allowed to load
 func (rc *RC) Allow() (err error) {
+	return rc.AllowWith(AllowOptions{})
+}
+
+// AllowWith grants the RC as allowed to load, recording the given options
+// in the allow file.
+func (rc *RC) AllowWith(opts AllowOptions) (err error) {
+	return rc.AllowRecordWith(NewAllowRecord(rc.path, opts))
+}
+
+// AllowRecordWith grants the RC as allowed to load with an existing record,
+// eg: one that has been imported from another machine.
+func (rc *RC) AllowRecordWith(record *AllowRecord) (err error) {
 	if rc.allowPath == "" {
 		return fmt.Errorf("cannot allow empty path")
 	}
 	if err = os.MkdirAll(filepath.Dir(rc.allowPath), 0755); err != nil {
 		return
 	}
-	if err = allow(rc.path, rc.allowPath); err != nil {
+	if err = record.Write(rc.allowPath); err != nil {
+		return
+	}
+	if err = rc.saveAllowedContent(); err != nil {
 		return
 	}
+	rc.config.audit(AuditAllow, rc.path, AuditAllowed, nil, nil)
 	if err = rc.times.Update(rc.allowPath); err != nil {
 		return
 	}
@@ -128,6 +157,7 @@ func (rc *RC) Deny() (err error) {
 	if err = os.WriteFile(rc.denyPath, []byte(rc.path+"\n"), 0644); /* #nosec G306 -- these deny files are not private */ err != nil {
 		return
 	}
+	rc.config.audit(AuditDeny, rc.path, AuditDenied, nil, nil)
 
 	if _, err = os.Stat(rc.allowPath); err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
@@ -160,10 +190,11 @@ func (rc *RC) Allowed() AllowStatus {
 	}
 
 	// happy path is if this envrc has been explicitly allowed, O(1)ish common case
-	_, err = os.Stat(rc.allowPath)
-
-	if err == nil {
-		return Allowed
+	if record, err := ReadAllowRecord(rc.allowPath); err == nil {
+		if !record.Expired(time.Now()) {
+			return Allowed
+		}
+		logDebug("allow record for %s expired at %s", rc.path, record.ExpiresAt)
 	}
 
 	// when whitelisting we want to be (path) absolutely sure we've not been duped with a symlink
@@ -173,21 +204,144 @@ func (rc *RC) Allowed() AllowStatus {
 		return NotAllowed
 	}
 
-	// exact whitelists are O(1)ish to check, so look there first
-	if rc.config.WhitelistExact[path] {
+	// the blacklist always wins over the whitelist
+	if rc.config.blacklisted(path) {
+		return NotAllowed
+	}
+
+	if rc.config.whitelisted(path) {
 		return Allowed
 	}
 
-	// finally we check if any of our whitelist prefixes match
-	for _, prefix := range rc.config.WhitelistPrefix {
-		if strings.HasPrefix(path, prefix) {
-			return Allowed
-		}
+	// the RC and its layers are committed in a trusted repository and haven't
+	// been modified
+	if rc.allFiles(func(path string) bool { return gitRemoteTrusted(path, rc.config.TrustGitRemotes) }) {
+		return Allowed
+	}
+
+	// the RC and its layers are approved by a manifest signed with a trusted key
+	if rc.allFiles(func(path string) bool { return manifestTrusted(path, rc.config.TrustPublicKeys) }) {
+		return Allowed
 	}
 
 	return NotAllowed
 }
 
+// allFiles returns true if fn is true for the RC file and all its layers.
+func (rc *RC) allFiles(fn func(path string) bool) bool {
+	for _, path := range rc.Files() {
+		if path, err := filepath.Abs(path); err != nil || !fn(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// Layers returns the existing rc_names files that get loaded on top of the
+// RC file, eg: .envrc.local for .envrc.
+func (rc *RC) Layers() []string {
+	return rc.config.rcLayers(rc.path)
+}
+
+// Files returns the RC file followed by its layers, in loading order.
+func (rc *RC) Files() []string {
+	return append([]string{rc.path}, rc.Layers()...)
+}
+
+// AllowRecord returns the allow record of the RC file, or nil if there is
+// none.
+func (rc *RC) AllowRecord() *AllowRecord {
+	record, err := ReadAllowRecord(rc.allowPath)
+	if err != nil {
+		return nil
+	}
+	return record
+}
+
+// AllowedContent returns the content of the file at path, the RC file or one
+// of its layers, as it was the last time the RC got allowed, or nil if no copy
+// was kept.
+func (rc *RC) AllowedContent(path string) ([]byte, error) {
+	contentPath, err := rc.allowContentPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return readFileIfExists(contentPath)
+}
+
+// ReviewDiff returns the unified diff between the last allowed content of
+// the RC file and its layers and their current content.
+func (rc *RC) ReviewDiff() (string, error) {
+	var diff strings.Builder
+	// Layers that got removed since are part of the changes too
+	for _, path := range append([]string{rc.path}, rc.config.layerCandidates(rc.path)...) {
+		allowed, err := rc.AllowedContent(path)
+		if err != nil {
+			return "", err
+		}
+		current, err := readFileIfExists(path)
+		if err != nil {
+			return "", err
+		}
+		fromName, toName := path+" (allowed)", path
+		if allowed == nil {
+			fromName = "/dev/null"
+		}
+		if current == nil {
+			toName = "/dev/null"
+		}
+		diff.WriteString(unifiedDiff(fromName, toName, allowed, current))
+	}
+	return diff.String(), nil
+}
+
+func (rc *RC) allowContentPath(path string) (string, error) {
+	pathHash, err := pathHash(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(rc.config.AllowContentDir(), pathHash), nil
+}
+
+// saveAllowedContent keeps a copy of the RC file and its layers, and forgets
+// the layers that don't exist anymore.
+func (rc *RC) saveAllowedContent() error {
+	if err := os.MkdirAll(rc.config.AllowContentDir(), 0755); err != nil {
+		return err
+	}
+	for _, path := range append([]string{rc.path}, rc.config.layerCandidates(rc.path)...) {
+		contentPath, err := rc.allowContentPath(path)
+		if err != nil {
+			return err
+		}
+		content, err := readFileIfExists(path)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			if err = os.Remove(contentPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		// The RC content might contain secrets, keep the copy private.
+		if err = os.WriteFile(contentPath, content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFileIfExists returns the content of the file at path, or nil if it
+// doesn't exist.
+func readFileIfExists(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return content, err
+}
+
 // Path returns the path to the RC file
 func (rc *RC) Path() string {
 	return rc.path
@@ -199,47 +353,172 @@ func (rc *RC) Touch() error {
 	return touch(rc.path)
 }
 
+var errCantFindBash = errors.New("can't find bash, set bash_path in direnv.toml")
+
 const notAllowed = "%s is blocked. Run `direnv allow` to approve its content"
 
+const allowExpired = "%s approval expired at %s. Run `direnv allow` to approve its content again"
+
+// LoadTimeoutError is returned by Load when the evaluation of the RC file
+// was aborted because it took longer than the configured load_timeout.
+type LoadTimeoutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (err LoadTimeoutError) Error() string {
+	return fmt.Sprintf("%s took longer than %s to load and was aborted. Run `direnv reload` to try again", err.Path, err.Timeout)
+}
+
 // Load evaluates the RC file and returns the new Env or error.
 //
 // This functions is key to the implementation of direnv.
 func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 	config := rc.config
-	wd := config.WorkDir
-	direnv := config.SelfPath
 	newEnv = previousEnv.Copy()
 	newEnv[DIRENV_WATCHES] = rc.times.Marshal()
+	allowed := rc.Allowed()
 	defer func() {
 		// Record directory changes even if load is disallowed or fails
 		newEnv[DIRENV_DIR] = "-" + filepath.Dir(rc.path)
 		newEnv[DIRENV_FILE] = rc.path
-		newEnv[DIRENV_DIFF] = previousEnv.Diff(newEnv).Serialize()
+		diff := config.EnvDiff(previousEnv, newEnv)
+		newEnv[DIRENV_DIFF] = diff.Serialize()
+		if config.PrivateState {
+			if stateErr := storeState(newEnv); stateErr != nil {
+				logError(config, "failed to store the state, keeping it in the environment: %v", stateErr)
+			}
+		}
+		config.audit(AuditLoad, rc.path, loadOutcome(allowed, err), err, diff)
 	}()
 
+	// The parents and the profile are extras: the failing ones are skipped
+	// rather than failing the whole load.
+	parents := rc.Parents()
+	profile, profileRC, profileErr := rc.ProfileRC()
+	if profileErr != nil {
+		logError(config, "failed to load the profile: %v", profileErr)
+	}
+	stack := append(parents, rc)
+	if profileRC != nil {
+		stack = append(stack, profileRC)
+	}
+
+	// Reload when any of the stacked files is changed, allowed or denied,
+	// and when the profile changes
+	var watches []string
+	for _, r := range stack {
+		if r != rc {
+			watches = append(watches, r.path, r.allowPath, r.denyPath)
+		}
+	}
+	if profilePath, pathErr := config.profilePath(filepath.Dir(rc.path)); pathErr == nil {
+		watches = append(watches, profilePath)
+	}
+	if profile != "" && profileRC == nil {
+		watches = append(watches, profileRCPath(rc.path, profile))
+	}
+	for _, path := range watches {
+		if watchErr := rc.times.Update(path); watchErr != nil {
+			logError(config, "failed to watch %s: %v", path, watchErr)
+		}
+	}
+
+	newEnv[DIRENV_WATCHES] = rc.times.Marshal()
+	if profile != "" {
+		newEnv[DIRENV_PROFILE] = profile
+	} else {
+		delete(newEnv, DIRENV_PROFILE)
+	}
+
 	// Abort if the file is not allowed
-	switch rc.Allowed() {
+	switch allowed {
 	case NotAllowed:
-		err = fmt.Errorf(notAllowed, rc.Path())
+		err = rc.notAllowedError()
 		return
 	case Allowed:
 	case Denied:
 		return
 	}
 
+	// The parents and the profile variant are only loaded if they are allowed
+	// too. Denied ones are skipped.
+	var toEval []*RC
+	for _, r := range stack {
+		if r != rc {
+			switch r.Allowed() {
+			case NotAllowed:
+				err = r.notAllowedError()
+				return
+			case Denied:
+				continue
+			}
+		}
+		toEval = append(toEval, r)
+	}
+
+	// Skip the evaluation if nothing changed since the last time
+	if config.CacheEnv {
+		if cachedEnv := rc.loadCachedEnv(previousEnv); cachedEnv != nil {
+			logStatus(config, "loading %s (cached)", userRelPath(config.Env, rc.path))
+			newEnv = cachedEnv
+			return
+		}
+	}
+
 	// Allow RC loads to be canceled with SIGINT
 	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, interruptSignals...)
+	defer signal.Stop(c)
 	go func() {
 		<-c
 		cancel()
 	}()
 
+	// And abort them if they take too long
+	if config.LoadTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, config.LoadTimeout)
+		defer cancelTimeout()
+	}
+
+	for _, r := range toEval {
+		for _, path := range r.Files() {
+			var nextEnv Env
+			if nextEnv, err = config.evalRC(ctx, path, newEnv); err != nil {
+				return
+			}
+			newEnv = nextEnv
+		}
+	}
+	if config.CacheEnv {
+		rc.storeCachedEnv(previousEnv, newEnv)
+	}
+
+	return
+}
+
+// evalRC runs the RC file at path in bash with the given environment and
+// returns the resulting one.
+func (config *Config) evalRC(ctx context.Context, path string, env Env) (newEnv Env, err error) {
+	if isTomlRC(path) {
+		newEnv, err = config.evalTomlRC(path, env)
+		if err == nil && config.provenance != nil {
+			config.provenance.record(config.DiffOptions, []string{path}, env, newEnv)
+		}
+		return
+	}
+	newEnv = env
+	if config.BashPath == "" {
+		err = errCantFindBash
+		return
+	}
+
 	// check what type of RC we're processing
 	// use different exec method for each
 	fn := "source_env"
-	if filepath.Base(rc.path) == ".env" {
+	if base := filepath.Base(path); base == ".env" || strings.HasPrefix(base, ".env.") {
 		fn = "dotenv"
 	}
 
@@ -262,11 +541,11 @@ func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 	// Non-Windows platforms will already use slashes. However, on Windows
 	// backslashes are used by default which can result in unexpected escapes
 	// like \b or \r in paths. Force slash usage to avoid issues on Windows.
-	slashSeparatedPath := filepath.ToSlash(rc.Path())
+	slashSeparatedPath := filepath.ToSlash(path)
 	arg := fmt.Sprintf(
 		`%seval "$("%s" stdlib)" && __main__ %s %s`,
 		prelude,
-		direnv,
+		config.SelfPath,
 		fn,
 		BashEscape(slashSeparatedPath),
 	)
@@ -274,23 +553,150 @@ func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 	// G204: Subprocess launched with function call as argument or cmd arguments
 	// #nosec
 	cmd := exec.CommandContext(ctx, config.BashPath, "-c", arg)
-	cmd.Dir = wd
-	cmd.Env = newEnv.ToGoEnv()
+	cmd.Dir = config.WorkDir
+	cmd.Env = env.ToGoEnv()
 	cmd.Stdin = stdin
+
+	// Have the stdlib snapshot the environment around each call
+	var provenancePath string
+	if config.provenance != nil {
+		var f *os.File
+		if f, err = os.CreateTemp("", "direnv-provenance."); err != nil {
+			return
+		}
+		provenancePath = f.Name()
+		_ = f.Close()
+		defer os.Remove(provenancePath)
+		cmd.Env = append(cmd.Env, DIRENV_PROVENANCE_FILE+"="+provenancePath)
+	}
 	cmd.Stderr = os.Stderr
+	if config.LoadTimeout > 0 {
+		// Don't wait for leftover processes holding on to stdout for long
+		killProcessGroupOnCancel(ctx, cmd, time.Second)
+	}
 
 	var out []byte
-	if out, err = cmd.Output(); err == nil && len(out) > 0 {
+	out, err = cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = LoadTimeoutError{path, config.LoadTimeout}
+		return
+	}
+	if err == nil && len(out) > 0 {
 		var newEnv2 Env
 		newEnv2, err = LoadEnvJSON(out)
 		if err == nil {
 			newEnv = newEnv2
 		}
 	}
+	if err == nil && provenancePath != "" {
+		var snapshots []byte
+		if snapshots, err = os.ReadFile(provenancePath); err == nil {
+			err = config.provenance.recordSnapshots(config.DiffOptions, snapshots, env, newEnv)
+		}
+	}
 
 	return
 }
 
+// notAllowedError explains why the RC file is not allowed to load.
+func (rc *RC) notAllowedError() error {
+	rc.logChangesSinceAllowed()
+	if record := rc.AllowRecord(); record != nil && record.Expired(time.Now()) {
+		return fmt.Errorf(allowExpired, rc.Path(), record.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	return fmt.Errorf(notAllowed, rc.Path())
+}
+
+// ProfileRC returns the active profile of the RC file's directory and the
+// variant of the RC file for it, if it exists.
+func (rc *RC) ProfileRC() (profile string, profileRC *RC, err error) {
+	dir := filepath.Dir(rc.path)
+	if profile, err = rc.config.Profile(dir); err != nil || profile == "" {
+		return
+	}
+	path := profileRCPath(rc.path, profile)
+	if !fileExists(path) {
+		return
+	}
+	profileRC, err = RCFromPath(path, rc.config)
+	return
+}
+
+// Parents returns the RC files of the parent directories that get loaded
+// before this one with load_parents, from the top-most one down. The ones
+// that can't be read are logged and skipped.
+func (rc *RC) Parents() []*RC {
+	config := rc.config
+	if !config.LoadParents {
+		return nil
+	}
+
+	dirs := eachDir(filepath.Dir(rc.path))
+	if config.ParentsBoundary != "" {
+		boundary := -1
+		for i, dir := range dirs {
+			if dir == config.ParentsBoundary {
+				boundary = i
+				break
+			}
+		}
+		// Outside of the boundary, nothing gets stacked
+		dirs = dirs[:boundary+1]
+	}
+
+	var parents []*RC
+	for i := len(dirs) - 1; i > 0; i-- {
+		path := findUp(dirs[i], config.RCNames...)
+		if path == "" || filepath.Dir(path) != dirs[i] {
+			continue
+		}
+		parent, err := RCFromPath(path, config)
+		if err != nil {
+			logError(config, "skipping %s: %v", path, err)
+			continue
+		}
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
+// loadOutcome summarizes the result of RC.Load for the audit log.
+func loadOutcome(allowed AllowStatus, err error) string {
+	switch {
+	case allowed == NotAllowed:
+		return AuditBlocked
+	case allowed == Denied:
+		return AuditDenied
+	case err != nil:
+		return AuditError
+	default:
+		return AuditAllowed
+	}
+}
+
+// maxBlockedDiffLines is the number of diff lines shown when a previously
+// allowed RC file got blocked because its content changed.
+const maxBlockedDiffLines = 40
+
+// logChangesSinceAllowed shows what changed in the RC file since it was last
+// allowed, if a copy of the allowed content is known.
+func (rc *RC) logChangesSinceAllowed() {
+	allowed, err := rc.AllowedContent(rc.path)
+	if err != nil || allowed == nil {
+		return
+	}
+	diff, err := rc.ReviewDiff()
+	if err != nil || diff == "" {
+		return
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n")
+	if len(lines) > maxBlockedDiffLines {
+		more := len(lines) - maxBlockedDiffLines
+		lines = append(lines[:maxBlockedDiffLines], fmt.Sprintf("\n... %d more lines, run `direnv allow --review` to see them all", more))
+	}
+	logStatus(rc.config, "%s changed since it was last allowed:\n%s", rc.Path(), strings.Join(lines, ""))
+}
+
 /// Utils
 
 func eachDir(path string) (paths []string) {
@@ -340,26 +746,44 @@ func fileExists(path string) bool {
 	return fi.Mode().IsRegular()
 }
 
-func fileHash(path string) (hash string, err error) {
-	if path, err = filepath.Abs(path); err != nil {
-		return
+// fileHash hashes the path and content of the file, followed by the ones of
+// the given layers if any.
+func fileHash(path string, layers ...string) (hash string, err error) {
+	hasher := sha256.New()
+	for i, p := range append([]string{path}, layers...) {
+		if p, err = filepath.Abs(p); err != nil {
+			return
+		}
+		if i > 0 {
+			if _, err = hasher.Write([]byte{0}); err != nil {
+				return
+			}
+		}
+		if _, err = hasher.Write([]byte(p + "\n")); err != nil {
+			return
+		}
+		if err = copyFile(hasher, p); err != nil {
+			return
+		}
 	}
 
-	fd, err := os.Open(path)
-	if err != nil {
-		return
-	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
 
-	hasher := sha256.New()
-	_, err = hasher.Write([]byte(path + "\n"))
+func copyFile(w io.Writer, path string) error {
+	fd, err := os.Open(path)
 	if err != nil {
-		return
-	}
-	if _, err = io.Copy(hasher, fd); err != nil {
-		return
+		return err
 	}
+	defer func() { _ = fd.Close() }()
+	_, err = io.Copy(w, fd)
+	return err
+}
 
-	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+// rcHash is the fileHash of the RC file at path and its layers, that the
+// allow files are named after.
+func rcHash(path string, config *Config) (string, error) {
+	return fileHash(path, config.rcLayers(path)...)
 }
 
 func pathHash(path string) (hash string, err error) {
@@ -383,17 +807,39 @@ func touch(path string) (err error) {
 	return os.Chtimes(path, t, t)
 }
 
-func allow(path string, allowPath string) (err error) {
-	// G306: Expect WriteFile permissions to be 0600 or less
-	// #nosec
-	return os.WriteFile(allowPath, []byte(path+"\n"), 0644)
+func findEnvUp(searchDir string, rcNames []string) (path string) {
+	return findUp(searchDir, rcNames...)
+}
+
+// layerCandidates returns the paths of the rc_names files that would be
+// layered on top of the RC file at path, eg: .envrc.local for .envrc.
+func (config *Config) layerCandidates(path string) (paths []string) {
+	base := filepath.Base(path)
+	for _, name := range config.RCNames {
+		// .envrc.toml is an alternative to .envrc, not a layer of it
+		if isTomlRC(name) && !isTomlRC(base) {
+			continue
+		}
+		if strings.HasPrefix(name, base+".") {
+			paths = append(paths, filepath.Join(filepath.Dir(path), name))
+		}
+	}
+	return
 }
 
-func findEnvUp(searchDir string, loadDotenv bool) (path string) {
-	if loadDotenv {
-		return findUp(searchDir, ".envrc", ".env")
+// rcLayers returns the existing layers of the RC file at path.
+func (config *Config) rcLayers(path string) (paths []string) {
+	for _, p := range config.layerCandidates(path) {
+		if fileExists(p) {
+			paths = append(paths, p)
+		}
 	}
-	return findUp(searchDir, ".envrc")
+	return
+}
+
+// rcNotFound is the error returned when no RC file could be found.
+func (config *Config) rcNotFound() error {
+	return fmt.Errorf("%s file not found", strings.Join(config.RCNames, " or "))
 }
 
 func findUp(searchDir string, fileNames ...string) (path string) {
@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -18,3 +21,171 @@ func TestSomething(t *testing.T) {
 		}
 	}
 }
+
+func TestParents(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{".envrc", "a/b/.envrc", "a/b/c/.envrc"} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{DataDir: t.TempDir(), RCNames: []string{".envrc"}, LoadParents: true, ParentsBoundary: filepath.Join(root, "a")}
+
+	rc, err := RCFromPath(filepath.Join(root, "a/b/c/.envrc"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents := rc.Parents()
+	if len(parents) != 1 || parents[0].Path() != filepath.Join(root, "a/b/.envrc") {
+		t.Errorf("expected only a/b/.envrc within the boundary, got %v", parents)
+	}
+
+	config.ParentsBoundary = ""
+	if parents = rc.Parents(); len(parents) != 2 || parents[0].Path() != filepath.Join(root, ".envrc") {
+		t.Errorf("expected .envrc and a/b/.envrc, got %v", parents)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{".envrc", ".envrc.local", ".env"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{DataDir: t.TempDir(), RCNames: []string{".envrc", ".envrc.local", ".env"}}
+
+	rc, err := FindRC(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := rc.Files()
+	if len(files) != 2 || files[0] != filepath.Join(root, ".envrc") || files[1] != filepath.Join(root, ".envrc.local") {
+		t.Errorf("expected .envrc layered by .envrc.local, got %v", files)
+	}
+
+	// The allow hash covers the layers
+	plain, err := fileHash(rc.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(rc.allowPath) == plain {
+		t.Error("expected the allow hash to depend on the layers")
+	}
+	if err = os.Remove(filepath.Join(root, ".envrc.local")); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _ := rcHash(rc.Path(), config); hash != plain {
+		t.Error("expected the allow hash without layers to be unchanged")
+	}
+}
+
+func TestReviewLayers(t *testing.T) {
+	root := t.TempDir()
+	local := filepath.Join(root, ".envrc.local")
+	for path, content := range map[string]string{filepath.Join(root, ".envrc"): "export FOO=a\n", local: "export BAR=a\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc", ".envrc.local"}}
+	rc, err := FindRC(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(local, []byte("export BAR=b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	review, err := rc.ReviewDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(review, "-export BAR=a") || !strings.Contains(review, "+export BAR=b") {
+		t.Errorf("expected the changes of the layer, got:\n%s", review)
+	}
+
+	// Removing a layer is a change too
+	if err = os.Remove(local); err != nil {
+		t.Fatal(err)
+	}
+	if review, _ = rc.ReviewDiff(); !strings.Contains(review, "+++ /dev/null") {
+		t.Errorf("expected the layer to be removed, got:\n%s", review)
+	}
+
+	// Until allowed again without it
+	if rc, err = FindRC(root, config); err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if review, _ = rc.ReviewDiff(); review != "" {
+		t.Errorf("expected no changes, got:\n%s", review)
+	}
+}
+
+func TestTomlIsNotALayer(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{".envrc", ".envrc.toml"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(""), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{DataDir: t.TempDir(), RCNames: []string{".envrc", ".envrc.toml"}}
+
+	rc, err := FindRC(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := rc.Files(); len(files) != 1 || files[0] != filepath.Join(root, ".envrc") {
+		t.Errorf("expected only .envrc to be loaded, got %v", files)
+	}
+	plain, err := fileHash(rc.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, _ := rcHash(rc.Path(), config); hash != plain {
+		t.Error("expected .envrc.toml not to be part of the allow hash")
+	}
+}
+
+func TestLoadSkipsBrokenProfile(t *testing.T) {
+	root := t.TempDir()
+	rcPath := filepath.Join(root, ".envrc.toml")
+	if err := os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{DataDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The profile can't be read
+	profilePath, err := config.profilePath(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(profilePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	newEnv, err := rc.Load(Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newEnv["FOO"] != "bar" || newEnv[DIRENV_FILE] != rcPath {
+		t.Errorf("expected the RC to be loaded without the profile, got %v", newEnv)
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/BurntSushi/toml"
+	"github.com/direnv/direnv/v2/pkg/dotenv"
+)
+
+// tomlRC is the declarative .envrc.toml format, evaluated without bash:
+//
+//	[dotenv]
+//	files = [".env"]
+//
+//	[env]
+//	DATABASE_URL = "postgres://localhost/${USER}"
+//
+//	[path]
+//	prepend = ["bin"]
+//	append = ["/opt/tools/bin"]
+//
+//	[watch]
+//	files = ["package.json"]
+type tomlRC struct {
+	Dotenv tomlRCFiles       `toml:"dotenv"`
+	Env    map[string]string `toml:"env"`
+	Path   tomlRCPath        `toml:"path"`
+	Watch  tomlRCFiles       `toml:"watch"`
+}
+
+type tomlRCFiles struct {
+	Files []string `toml:"files"`
+}
+
+type tomlRCPath struct {
+	Prepend []string `toml:"prepend"`
+	Append  []string `toml:"append"`
+}
+
+// isTomlRC returns true if the RC file at path is in the declarative format.
+func isTomlRC(path string) bool {
+	return filepath.Ext(path) == ".toml"
+}
+
+// evalTomlRC applies the declarative RC file at path to env. The sections
+// are applied in this order: dotenv, env, path and watch. Relative paths are
+// relative to the directory of the RC file.
+func (config *Config) evalTomlRC(path string, env Env) (newEnv Env, err error) {
+	var rc tomlRC
+	md, err := toml.DecodeFile(path, &rc)
+	if err != nil {
+		return env, fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return env, fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+	}
+
+	logStatus(config, "loading %s", userRelPath(env, path))
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		p = expandTildePath(p)
+		if filepath.IsAbs(p) {
+			return filepath.Clean(p)
+		}
+		return filepath.Join(dir, p)
+	}
+
+	newEnv = env.Copy()
+	times := NewFileTimes()
+	if err = times.Unmarshal(newEnv[DIRENV_WATCHES]); err != nil {
+		return env, err
+	}
+
+	for _, p := range rc.Dotenv.Files {
+		p = resolve(p)
+		if err = times.Update(p); err != nil {
+			return env, err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return env, err
+		}
+		vars, err := dotenv.Parse(string(data))
+		if err != nil {
+			return env, fmt.Errorf("%s: %w", p, err)
+		}
+		for key, value := range vars {
+			newEnv[key] = value
+		}
+	}
+
+	// Follow the order of the file, so values can refer to the previous ones
+	for _, key := range md.Keys() {
+		if len(key) != 2 || key[0] != "env" {
+			continue
+		}
+		name := key[1]
+		newEnv[name] = os.Expand(rc.Env[name], func(v string) string {
+			return newEnv[v]
+		})
+	}
+
+	if len(rc.Path.Prepend) > 0 || len(rc.Path.Append) > 0 {
+		var elements []string
+		for _, p := range rc.Path.Prepend {
+			elements = append(elements, resolve(p))
+		}
+		if newEnv["PATH"] != "" {
+			elements = append(elements, newEnv["PATH"])
+		}
+		for _, p := range rc.Path.Append {
+			elements = append(elements, resolve(p))
+		}
+		newEnv["PATH"] = strings.Join(elements, string(os.PathListSeparator))
+	}
+
+	for _, p := range rc.Watch.Files {
+		if err = times.Update(resolve(p)); err != nil {
+			return env, err
+		}
+	}
+	newEnv[DIRENV_WATCHES] = times.Marshal()
+
+	return newEnv, nil
+}
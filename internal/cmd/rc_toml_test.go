@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvalTomlRC(t *testing.T) {
+	dir := t.TempDir()
+	rcPath := filepath.Join(dir, ".envrc.toml")
+	content := `
+[dotenv]
+files = [".env"]
+
+[env]
+NAME = "app"
+URL = "postgres://localhost/${NAME}?user=$USER"
+
+[path]
+prepend = ["bin"]
+append = ["/opt/tools/bin"]
+
+[watch]
+files = ["package.json"]
+`
+	if err := os.WriteFile(rcPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{}
+	times := NewFileTimes()
+	env := Env{"USER": "alice", "PATH": "/usr/bin", DIRENV_WATCHES: times.Marshal()}
+	newEnv, err := config.evalTomlRC(rcPath, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]string{
+		"SECRET": "s3cr3t",
+		"NAME":   "app",
+		"URL":    "postgres://localhost/app?user=alice",
+		"PATH":   strings.Join([]string{filepath.Join(dir, "bin"), "/usr/bin", "/opt/tools/bin"}, string(os.PathListSeparator)),
+	} {
+		if newEnv[key] != expected {
+			t.Errorf("%s = %q, expected %q", key, newEnv[key], expected)
+		}
+	}
+
+	times = NewFileTimes()
+	if err = times.Unmarshal(newEnv[DIRENV_WATCHES]); err != nil {
+		t.Fatal(err)
+	}
+	var watched []string
+	for _, ft := range *times.list {
+		watched = append(watched, filepath.Base(ft.Path))
+	}
+	if strings.Join(watched, " ") != ".env package.json" {
+		t.Errorf("expected .env and package.json to be watched, got %v", watched)
+	}
+
+	if err = os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n[unknown]\nkey = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = config.evalTomlRC(rcPath, env); err == nil {
+		t.Error("expected an error for unknown keys")
+	}
+}
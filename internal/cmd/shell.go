@@ -39,6 +39,8 @@ var supportedShellList = map[string]Shell{
 	"gzenv":   GzEnv,
 	"json":    JSON,
 	"murex":   Murex,
+	"nu":      Nushell,
+	"xonsh":   Xonsh,
 	"tcsh":    Tcsh,
 	"vim":     Vim,
 	"zsh":     Zsh,
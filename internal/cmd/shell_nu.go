@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+type nu struct{}
+
+// Nushell adds support for the nu shell
+var Nushell Shell = nu{}
+
+// The hook runs on each prompt, like in the other shells, so changes to the
+// .envrc are picked up without changing directory.
+func (nu) Hook() (string, error) {
+	return `# hook for direnv
+$env.config = ($env.config | upsert hooks.pre_prompt (
+	($env.config.hooks.pre_prompt? | default []) | append {||
+		let output = (^'{{.SelfPath}}' export nu | str trim)
+		if ($output | is-empty) {
+			return
+		}
+		let changes = ($output | from json)
+		if ($changes | is-empty) {
+			return
+		}
+		let removed = ($changes | transpose key value | where value == null | get key)
+		if not ($removed | is-empty) {
+			hide-env --ignore-errors ...$removed
+		}
+		$changes | reject ...$removed | load-env
+	}
+))
+`, nil
+}
+
+// Export outputs a record that load-env can apply. The variables to remove
+// are set to null.
+func (sh nu) Export(e ShellExport) (string, error) {
+	record := make(map[string]interface{}, len(e))
+	for key, value := range e {
+		if value == nil {
+			record[key] = nil
+		} else {
+			record[key] = sh.value(key, *value)
+		}
+	}
+	return sh.encode(record)
+}
+
+func (sh nu) Dump(env Env) (string, error) {
+	record := make(map[string]interface{}, len(env))
+	for key, value := range env {
+		record[key] = sh.value(key, value)
+	}
+	return sh.encode(record)
+}
+
+// value converts PATH to a list, which is how nushell represents it.
+func (nu) value(key, value string) interface{} {
+	if !strings.EqualFold(key, "PATH") {
+		return value
+	}
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, string(os.PathListSeparator))
+}
+
+func (nu) encode(record map[string]interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := json.NewEncoder(buf).Encode(record)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var (
+	_ Shell = (*nu)(nil)
+)
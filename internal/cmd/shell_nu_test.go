@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNushellExport(t *testing.T) {
+	e := make(ShellExport)
+	e.Add("FOO", `a "quoted" value`)
+	e.Add("PATH", "/a"+string(os.PathListSeparator)+"/b")
+	e.Remove("BAR")
+
+	out, err := Nushell.Export(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]interface{}
+	if err = json.Unmarshal([]byte(out), &record); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"FOO":  `a "quoted" value`,
+		"PATH": []interface{}{"/a", "/b"},
+		"BAR":  nil,
+	}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("expected %v, got %v", expected, record)
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+)
+
+type xonsh struct{}
+
+// Xonsh adds support for the python-based xonsh shell
+var Xonsh Shell = xonsh{}
+
+// The hook runs on each prompt, like in the other shells, so changes to the
+// .envrc are picked up without changing directory. direnv is given the xonsh
+// environment, which isn't always in sync with os.environ.
+func (xonsh) Hook() (string, error) {
+	return `# hook for direnv
+@events.on_pre_prompt
+def __direnv_hook(**kwargs):
+    import subprocess
+    out = subprocess.run(
+        [{{printf "%q" .SelfPath}}, "export", "xonsh"],
+        stdout=subprocess.PIPE,
+        env=${...}.detype(),
+        text=True,
+    ).stdout
+    if out:
+        execx(out)
+`, nil
+}
+
+func (sh xonsh) Export(e ShellExport) (string, error) {
+	var out strings.Builder
+	for key, value := range e {
+		if value == nil {
+			out.WriteString(sh.unset(key))
+		} else {
+			out.WriteString(sh.export(key, *value))
+		}
+	}
+	return out.String(), nil
+}
+
+func (sh xonsh) Dump(env Env) (string, error) {
+	var out strings.Builder
+	for key, value := range env {
+		out.WriteString(sh.export(key, value))
+	}
+	return out.String(), nil
+}
+
+func (sh xonsh) export(key, value string) string {
+	return "${...}[" + sh.escape(key) + "] = " + sh.escape(value) + "\n"
+}
+
+func (sh xonsh) unset(key string) string {
+	return "${...}.pop(" + sh.escape(key) + ", None)\n"
+}
+
+// escape returns a python string literal. For valid UTF-8, the escape
+// sequences of Go's double-quoted strings have the same meaning in python.
+func (xonsh) escape(str string) string {
+	return strconv.Quote(str)
+}
+
+var (
+	_ Shell = (*xonsh)(nil)
+)
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestXonshExport(t *testing.T) {
+	e := make(ShellExport)
+	e.Add("FOO", "it's a \"test\"\n\\ é ${HOME}")
+	out, err := Xonsh.Export(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, `${...}["FOO"] = "it's a \"test\"\n\\ é ${HOME}"`+"\n", out)
+
+	e = make(ShellExport)
+	e.Remove("FOO")
+	out, err = Xonsh.Export(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, `${...}.pop("FOO", None)`+"\n", out)
+}
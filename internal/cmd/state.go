@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/direnv/direnv/v2/xdg"
+)
+
+// stateTokenRe matches the tokens of DIRENV_STATE, so they can't point
+// outside of the state dir.
+var stateTokenRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// sessionState is the content of a state file, that holds DIRENV_DIFF and
+// DIRENV_WATCHES with private_state.
+type sessionState struct {
+	Diff    string `json:"diff"`
+	Watches string `json:"watches"`
+}
+
+// stateDir is the private folder where the state files are stored. It is
+// under XDG_RUNTIME_DIR, so it is emptied on logout.
+func stateDir(env Env) string {
+	return xdg.RuntimeDir(env, "direnv")
+}
+
+// stateMaxIdle is how long a state file can go unread before `direnv prune`
+// removes it. They are read on each prompt of the shell that refers to them.
+const stateMaxIdle = 7 * 24 * time.Hour
+
+// storeState moves DIRENV_DIFF and DIRENV_WATCHES from env to a new state
+// file, and replaces them with its token in DIRENV_STATE.
+//
+// State files are never overwritten nor removed on unload: the token is
+// inherited by the sub-shells, tmux panes, ... that might still need the
+// state it points to. pruneStates removes the ones that are no longer read.
+func storeState(env Env) error {
+	dir := stateDir(env)
+	if dir == "" {
+		return errors.New("private_state requires XDG_RUNTIME_DIR to be set")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+
+	data, err := json.Marshal(sessionState{Diff: env[DIRENV_DIFF], Watches: env[DIRENV_WATCHES]})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, token), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	delete(env, DIRENV_DIFF)
+	delete(env, DIRENV_WATCHES)
+	env[DIRENV_STATE] = token
+	return nil
+}
+
+// loadedState returns DIRENV_DIFF and DIRENV_WATCHES, from the environment or
+// else from the state file of DIRENV_STATE.
+func (env Env) loadedState() (diff, watches string) {
+	diff, watches = env[DIRENV_DIFF], env[DIRENV_WATCHES]
+	token := env[DIRENV_STATE]
+	if diff != "" || watches != "" || token == "" {
+		return
+	}
+
+	dir := stateDir(env)
+	if dir == "" || !stateTokenRe.MatchString(token) {
+		logDebug("invalid DIRENV_STATE %q", token)
+		return
+	}
+	statePath := filepath.Join(dir, token)
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		logDebug("state: %v", err)
+		return
+	}
+	// Record the use, for pruneStates
+	now := time.Now()
+	_ = os.Chtimes(statePath, now, now)
+	var state sessionState
+	if err = json.Unmarshal(data, &state); err != nil {
+		logDebug("state: %s: %v", token, err)
+		return
+	}
+	return state.Diff, state.Watches
+}
+
+// pruneStates removes the state files that no shell used recently, eg: left
+// by shells that exited without unloading.
+func pruneStates(config *Config) error {
+	dir := stateDir(config.Env)
+	if dir == "" {
+		return nil
+	}
+	names, err := readDirNames(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		statePath := filepath.Join(dir, name)
+		if fi, err := os.Stat(statePath); err == nil && time.Since(fi.ModTime()) > stateMaxIdle {
+			_ = os.Remove(statePath)
+		}
+	}
+	return nil
+}
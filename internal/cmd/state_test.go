@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreState(t *testing.T) {
+	runtimeDir := t.TempDir()
+	env := Env{"XDG_RUNTIME_DIR": runtimeDir, DIRENV_DIFF: "diff", DIRENV_WATCHES: "watches", "FOO": "bar"}
+
+	if err := storeState(env); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := env[DIRENV_DIFF]; ok {
+		t.Error("expected DIRENV_DIFF to be removed from the environment")
+	}
+	if _, ok := env[DIRENV_WATCHES]; ok {
+		t.Error("expected DIRENV_WATCHES to be removed from the environment")
+	}
+
+	fi, err := os.Stat(filepath.Join(runtimeDir, "direnv", env[DIRENV_STATE]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the state file to be private, got %v", fi.Mode())
+	}
+
+	if diff, watches := env.loadedState(); diff != "diff" || watches != "watches" {
+		t.Errorf("unexpected state %q %q", diff, watches)
+	}
+
+	// The token can't point outside of the state dir
+	env[DIRENV_STATE] = "../" + env[DIRENV_STATE]
+	if diff, _ := env.loadedState(); diff != "" {
+		t.Errorf("expected an invalid token to be ignored, got %q", diff)
+	}
+
+	if err := storeState(Env{DIRENV_DIFF: "diff"}); err == nil {
+		t.Error("expected an error without XDG_RUNTIME_DIR")
+	}
+}
+
+func TestChildUnloadKeepsState(t *testing.T) {
+	runtimeDir := t.TempDir()
+	rcPath := filepath.Join(t.TempDir(), ".envrc.toml")
+	if err := os.WriteFile(rcPath, []byte("[env]\nFOO = \"bar\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{DataDir: t.TempDir(), CacheDir: t.TempDir(), Env: Env{}, RCNames: []string{".envrc.toml"}, PrivateState: true}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	parentEnv, err := rc.Load(Env{"XDG_RUNTIME_DIR": runtimeDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parentEnv[DIRENV_STATE] == "" {
+		t.Fatal("expected the state to be private")
+	}
+
+	// A sub-shell inherits the token and leaves the project
+	childEnv := parentEnv.Copy()
+	childConfig := &Config{Env: childEnv, WorkDir: t.TempDir(), RCNames: []string{".envrc.toml"}, PrivateState: true}
+	if err = exportCommand(childEnv, []string{"export", "bash"}, childConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent can still unload
+	parentConfig := &Config{Env: parentEnv}
+	previousEnv, err := parentConfig.Revert(parentEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := previousEnv["FOO"]; ok {
+		t.Errorf("expected the parent to revert FOO, got %v", previousEnv)
+	}
+}
+
+func TestPruneStates(t *testing.T) {
+	runtimeDir := t.TempDir()
+	config := &Config{Env: Env{"XDG_RUNTIME_DIR": runtimeDir}}
+	used := Env{"XDG_RUNTIME_DIR": runtimeDir, DIRENV_DIFF: "diff"}
+	unused := Env{"XDG_RUNTIME_DIR": runtimeDir, DIRENV_DIFF: "diff"}
+	for _, env := range []Env{used, unused} {
+		if err := storeState(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * stateMaxIdle)
+	for _, env := range []Env{used, unused} {
+		if err := os.Chtimes(filepath.Join(runtimeDir, "direnv", env[DIRENV_STATE]), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Reading the state records its use
+	if diff, _ := used.loadedState(); diff != "diff" {
+		t.Fatalf("unexpected diff %q", diff)
+	}
+
+	if err := pruneStates(config); err != nil {
+		t.Fatal(err)
+	}
+	if diff, _ := used.loadedState(); diff != "diff" {
+		t.Errorf("expected the used state to be kept, got %q", diff)
+	}
+	if _, err := os.Stat(filepath.Join(runtimeDir, "direnv", unused[DIRENV_STATE])); !os.IsNotExist(err) {
+		t.Errorf("expected the unused state to be removed, got %v", err)
+	}
+}
+
+func TestRevertStripsState(t *testing.T) {
+	runtimeDir := t.TempDir()
+	env := Env{"XDG_RUNTIME_DIR": runtimeDir, "FOO": "bar"}
+	diff := BuildEnvDiff(Env{"XDG_RUNTIME_DIR": runtimeDir}, env)
+	env[DIRENV_DIFF] = diff.Serialize()
+	if err := storeState(env); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{Env: env}
+	previousEnv, err := config.Revert(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := previousEnv[DIRENV_STATE]; ok {
+		t.Error("expected DIRENV_STATE to be removed from the reverted environment")
+	}
+	if _, ok := previousEnv["FOO"]; ok {
+		t.Error("expected FOO to be reverted")
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	to := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+`
+	assertEqual(t, expected, unifiedDiff("old", "new", []byte(from), []byte(to)))
+	assertEqual(t, "", unifiedDiff("old", "new", []byte(from), []byte(from)))
+	assertEqual(t, "--- old\n+++ new\n@@ -0,0 +1 @@\n+x\n", unifiedDiff("old", "new", nil, []byte("x\n")))
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	from := strings.Repeat("a\n", 3000)
+	to := from + "b\n"
+	assertEqual(t, "--- old\n+++ new\ncontent changed, too large to show the differences (3000 -> 3001 lines)\n", unifiedDiff("old", "new", []byte(from), []byte(to)))
+	assertEqual(t, "", unifiedDiff("old", "new", []byte(from), []byte(from)))
+}
@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrustStatus is the state of an RC file as recorded in the trust stores.
+type TrustStatus string
+
+const (
+	// TrustAllowed means the current content of the RC file is allowed.
+	TrustAllowed TrustStatus = "allowed"
+	// TrustExpired means the current content was allowed but the approval lapsed.
+	TrustExpired TrustStatus = "expired"
+	// TrustStale means the RC file changed since it was allowed.
+	TrustStale TrustStatus = "stale"
+	// TrustDenied means the RC file has been explicitly denied.
+	TrustDenied TrustStatus = "denied"
+	// TrustMissing means the RC file doesn't exist anymore.
+	TrustMissing TrustStatus = "missing"
+	// TrustUnknown means the RC file isn't recorded in any of the stores.
+	TrustUnknown TrustStatus = "unknown"
+)
+
+// TrustEntry is everything direnv knows about the trust of a single RC file.
+type TrustEntry struct {
+	Path     string          `json:"path"`
+	Status   TrustStatus     `json:"status"`
+	Record   *AllowRecord    `json:"record,omitempty"`
+	Required []RequiredEntry `json:"required,omitempty"`
+}
+
+// RequiredEntry is a file approved through `require_allowed` for an RC file.
+type RequiredEntry struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	Current bool   `json:"current"`
+}
+
+// LoadTrustEntries walks the allow, deny and allowed-required stores and
+// returns one entry per known RC file, sorted by path.
+func LoadTrustEntries(config *Config) ([]*TrustEntry, error) {
+	now := time.Now()
+	entries := make(map[string]*TrustEntry)
+
+	err := eachAllowRecord(config, func(hash string, record *AllowRecord) error {
+		entry := entries[record.Path]
+		if entry == nil {
+			entry = &TrustEntry{Path: record.Path, Status: TrustStale}
+			entries[record.Path] = entry
+		}
+		if h, err := rcHash(record.Path, config); err != nil || h != hash {
+			// Keep the most recent of the outdated records around for display
+			if entry.Status == TrustStale && (entry.Record == nil || entry.Record.AllowedAt.Before(record.AllowedAt)) {
+				entry.Record = record
+			}
+			return nil
+		}
+		entry.Record = record
+		if record.Expired(now) {
+			entry.Status = TrustExpired
+		} else {
+			entry.Status = TrustAllowed
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	denied, err := readDirNames(config.DenyDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range denied {
+		content, err := os.ReadFile(filepath.Join(config.DenyDir(), hash))
+		if err != nil {
+			return nil, err
+		}
+		rcPath := strings.TrimSpace(string(content))
+		if rcPath == "" {
+			continue
+		}
+		entry := entries[rcPath]
+		if entry == nil {
+			entry = &TrustEntry{Path: rcPath}
+			entries[rcPath] = entry
+		}
+		entry.Status = TrustDenied
+	}
+
+	list := make([]*TrustEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Status != TrustDenied && !fileExists(entry.Path) {
+			entry.Status = TrustMissing
+		}
+		if entry.Required, err = loadRequiredEntries(config, entry.Path); err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return list, nil
+}
+
+// loadRequiredEntries returns the files approved through `require_allowed`
+// for the RC file at rcPath.
+func loadRequiredEntries(config *Config, rcPath string) ([]RequiredEntry, error) {
+	envrcPathHash, err := pathHash(rcPath)
+	if err != nil {
+		return nil, err
+	}
+	subdir := filepath.Join(config.AllowedRequiredDir(), envrcPathHash)
+	hashes, err := readDirNames(subdir)
+	if err != nil {
+		return nil, err
+	}
+
+	var required []RequiredEntry
+	for _, hash := range hashes {
+		content, err := os.ReadFile(filepath.Join(subdir, hash))
+		if err != nil {
+			continue
+		}
+		relPath := strings.TrimSpace(string(content))
+		h, err := fileHash(filepath.Join(filepath.Dir(rcPath), relPath))
+		required = append(required, RequiredEntry{
+			Path:    relPath,
+			Hash:    hash,
+			Current: err == nil && h == hash,
+		})
+	}
+	sort.Slice(required, func(i, j int) bool {
+		return required[i].Path < required[j].Path
+	})
+	return required, nil
+}
+
+// eachAllowRecord calls fn with every record stored in the allow dir, along
+// with the hash it's stored under. The files that can't be read or parsed are
+// logged and skipped, so a bad file doesn't hide the others. Only the ones
+// that can't be parsed are passed to invalid, if not nil.
+func eachAllowRecord(config *Config, fn func(hash string, record *AllowRecord) error, invalid func(filename string)) error {
+	allowed := config.AllowDir()
+	dirList, err := readDirNames(allowed)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range dirList {
+		filename := filepath.Join(allowed, hash)
+		fi, err := os.Stat(filename)
+		if err != nil {
+			logDebug("allow record: %v", err)
+			continue
+		}
+		if fi.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			// Might be readable again later, eg: once the permissions are fixed
+			logError(config, "skipping %s: %v", filename, err)
+			continue
+		}
+		record, err := ParseAllowRecord(data)
+		if err != nil {
+			logError(config, "skipping %s: %v", filename, err)
+			if invalid != nil {
+				invalid(filename)
+			}
+			continue
+		}
+		// skip old files, w/o path inside
+		if record.Path == "" {
+			continue
+		}
+		if err = fn(hash, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDirNames returns the names of the entries of dir. A missing dir is
+// treated as being empty.
+func readDirNames(dirname string) ([]string, error) {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() {
+		if err := dir.Close(); err != nil {
+			log.Printf("Warning: failed to close directory: %v", err)
+		}
+	}()
+
+	return dir.Readdirnames(0)
+}
+
+// TrustExport is the portable form of the trust stores. Unlike the stores
+// themselves, it identifies files by the sha256 of their content so that it
+// can be imported on another machine.
+type TrustExport struct {
+	Version int                `json:"version"`
+	Entries []TrustExportEntry `json:"entries"`
+}
+
+// TrustExportEntry is an allowed or denied RC file.
+type TrustExportEntry struct {
+	Path     string            `json:"path"`
+	Status   TrustStatus       `json:"status"`
+	SHA256   string            `json:"sha256,omitempty"`
+	Record   *AllowRecord      `json:"record,omitempty"`
+	Required []TrustExportFile `json:"required,omitempty"`
+}
+
+// TrustExportFile is a file approved through `require_allowed`, relative to
+// the RC file.
+type TrustExportFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportTrust returns the currently allowed and denied RC files.
+func ExportTrust(config *Config) (*TrustExport, error) {
+	entries, err := LoadTrustEntries(config)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &TrustExport{Version: 1, Entries: make([]TrustExportEntry, 0)}
+	for _, entry := range entries {
+		switch entry.Status {
+		case TrustDenied:
+			export.Entries = append(export.Entries, TrustExportEntry{Path: entry.Path, Status: TrustDenied})
+		case TrustAllowed:
+			sum, err := contentHash(entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			e := TrustExportEntry{Path: entry.Path, Status: TrustAllowed, SHA256: sum, Record: entry.Record}
+			for _, required := range entry.Required {
+				if !required.Current {
+					continue
+				}
+				sum, err := contentHash(filepath.Join(filepath.Dir(entry.Path), required.Path))
+				if err != nil {
+					return nil, err
+				}
+				e.Required = append(e.Required, TrustExportFile{Path: required.Path, SHA256: sum})
+			}
+			export.Entries = append(export.Entries, e)
+		}
+	}
+	return export, nil
+}
+
+// ImportTrust records the entries of an export in the trust stores. Paths are
+// passed through rebase first. Allowed entries are only imported if the
+// content of the file still matches. It returns a message for each skipped
+// entry.
+func ImportTrust(config *Config, export *TrustExport, rebase func(string) string) (imported int, skipped []string, err error) {
+	if export.Version != 1 {
+		return 0, nil, fmt.Errorf("unsupported trust export version %d", export.Version)
+	}
+
+	for _, entry := range export.Entries {
+		rcPath := rebase(entry.Path)
+		if !fileExists(rcPath) {
+			skipped = append(skipped, fmt.Sprintf("%s: file not found", rcPath))
+			continue
+		}
+		rc, err := RCFromPath(rcPath, config)
+		if err != nil {
+			return imported, skipped, err
+		}
+
+		switch entry.Status {
+		case TrustDenied:
+			if err = rc.Deny(); err != nil {
+				return imported, skipped, err
+			}
+		case TrustAllowed:
+			if sum, err := contentHash(rcPath); err != nil || sum != entry.SHA256 {
+				skipped = append(skipped, fmt.Sprintf("%s: content changed", rcPath))
+				continue
+			}
+			// The export doesn't cover the local layers, they need a review
+			if layers := rc.Layers(); len(layers) > 0 {
+				skipped = append(skipped, fmt.Sprintf("%s: layered by %s", rcPath, strings.Join(layers, ", ")))
+				continue
+			}
+			record := entry.Record
+			if record == nil {
+				record = NewAllowRecord(rcPath, AllowOptions{})
+			}
+			record.Path = rcPath
+			if err = rc.AllowRecordWith(record); err != nil {
+				return imported, skipped, err
+			}
+			for _, required := range entry.Required {
+				requiredPath := filepath.Join(filepath.Dir(rcPath), required.Path)
+				if sum, err := contentHash(requiredPath); err != nil || sum != required.SHA256 {
+					skipped = append(skipped, fmt.Sprintf("%s: content changed", requiredPath))
+					continue
+				}
+				if err = allowRequiredFile(rcPath, required.Path, config); err != nil {
+					return imported, skipped, err
+				}
+			}
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s: unknown status %q", rcPath, entry.Status))
+			continue
+		}
+		imported++
+	}
+
+	return imported, skipped, nil
+}
+
+// contentHash returns the sha256 of the file content, independently of its
+// location.
+func contentHash(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content)), nil
+}
@@ -0,0 +1,413 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TrustManifestPath is where team-shared manifests are looked up, relative to
+// the project root.
+const TrustManifestPath = ".direnv/trust.json"
+
+// TrustManifest is a checked-in list of approved RC files, signed by one or
+// more trusted keys.
+//
+// RC files are identified by their path relative to the project root (the
+// parent of the .direnv folder) and the sha256 of their content. Unlike the
+// allow files, this doesn't depend on where the project is checked out. The
+// signatures also cover the project, the origin remote of its git repository,
+// so that they don't apply once copied to another one.
+type TrustManifest struct {
+	Version    int                 `json:"version"`
+	Project    string              `json:"project"`
+	Entries    []TrustManifestItem `json:"entries"`
+	Signatures []TrustSignature    `json:"signatures,omitempty"`
+}
+
+// TrustManifestItem is an approved RC file.
+type TrustManifestItem struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// TrustSignature is the signature of the manifest entries by a key.
+type TrustSignature struct {
+	Key       string `json:"key"`
+	Signature string `json:"signature"`
+}
+
+// findTrustManifest looks for the nearest manifest up from dir and returns
+// its path and the project root.
+func findTrustManifest(dir string) (manifestPath, root string) {
+	for _, d := range eachDir(dir) {
+		p := filepath.Join(d, TrustManifestPath)
+		if fileExists(p) {
+			return p, d
+		}
+	}
+	return "", ""
+}
+
+// trustManifestRoot returns the project root of the manifest at
+// manifestPath, which must be ROOT/.direnv/trust.json: it is where the
+// manifest is looked for, relative to the files it approves.
+func trustManifestRoot(manifestPath string) (string, error) {
+	suffix := string(filepath.Separator) + filepath.FromSlash(TrustManifestPath)
+	root, ok := strings.CutSuffix(filepath.Clean(manifestPath), suffix)
+	if !ok {
+		return "", fmt.Errorf("%s: the manifest must be at %s in the project root", manifestPath, TrustManifestPath)
+	}
+	if root == "" {
+		root = string(filepath.Separator)
+	}
+	return root, nil
+}
+
+// trustManifestProject returns the identity of the project at root: the URL
+// of the origin remote of the enclosing git repository.
+func trustManifestProject(root string) (string, error) {
+	repo := findGitRepo(root)
+	if repo == nil {
+		return "", fmt.Errorf("%s is not in a git repository", root)
+	}
+	url, err := repo.remoteURL("origin")
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		return "", fmt.Errorf("the git repository of %s has no origin remote", root)
+	}
+	return url, nil
+}
+
+// LoadTrustManifest reads the manifest at path.
+func LoadTrustManifest(path string) (*TrustManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(TrustManifest)
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid trust manifest %s: %w", path, err)
+	}
+	if manifest.Version != 1 {
+		return nil, fmt.Errorf("unsupported trust manifest version %d in %s", manifest.Version, path)
+	}
+	return manifest, nil
+}
+
+// Write stores the manifest at path.
+func (m *TrustManifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// G306: Expect WriteFile permissions to be 0600 or less
+	// #nosec
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// payload returns the bytes covered by the signatures.
+func (m *TrustManifest) payload() []byte {
+	entries := append([]TrustManifestItem(nil), m.Entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	data, _ := json.Marshal(struct {
+		Version int                 `json:"version"`
+		Project string              `json:"project"`
+		Entries []TrustManifestItem `json:"entries"`
+	}{m.Version, m.Project, entries})
+	return append([]byte("direnv-trust-manifest\n"), data...)
+}
+
+// Set adds or updates the entry for the RC file at relPath. Existing
+// signatures are dropped as they don't cover the new content.
+func (m *TrustManifest) Set(relPath string, content []byte) {
+	item := TrustManifestItem{
+		Path:   filepath.ToSlash(relPath),
+		SHA256: fmt.Sprintf("%x", sha256.Sum256(content)),
+	}
+	m.Signatures = nil
+	for i := range m.Entries {
+		if m.Entries[i].Path == item.Path {
+			m.Entries[i] = item
+			return
+		}
+	}
+	m.Entries = append(m.Entries, item)
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+}
+
+// SetProject binds the manifest to the project. Existing signatures are
+// dropped if it changes.
+func (m *TrustManifest) SetProject(project string) {
+	if m.Project != project {
+		m.Project = project
+		m.Signatures = nil
+	}
+}
+
+// Sign adds the signature of the given key, replacing any previous signature
+// from the same key.
+func (m *TrustManifest) Sign(key ed25519.PrivateKey) {
+	pub := FormatTrustPublicKey(key.Public().(ed25519.PublicKey))
+	sig := TrustSignature{
+		Key:       pub,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, m.payload())),
+	}
+	for i := range m.Signatures {
+		if m.Signatures[i].Key == pub {
+			m.Signatures[i] = sig
+			return
+		}
+	}
+	m.Signatures = append(m.Signatures, sig)
+}
+
+// Verify returns true if the manifest carries a valid signature from any of
+// the trusted keys.
+func (m *TrustManifest) Verify(trusted []ed25519.PublicKey) bool {
+	payload := m.payload()
+	for _, sig := range m.Signatures {
+		pub, err := ParseTrustPublicKey(sig.Key)
+		if err != nil {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+		if err != nil {
+			continue
+		}
+		for _, key := range trusted {
+			if key.Equal(pub) && ed25519.Verify(key, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Contains returns true if the manifest approves the given content for the
+// RC file at relPath.
+func (m *TrustManifest) Contains(relPath string, content []byte) bool {
+	relPath = filepath.ToSlash(relPath)
+	sum := fmt.Sprintf("%x", sha256.Sum256(content))
+	for _, item := range m.Entries {
+		if item.Path == relPath && item.SHA256 == sum {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestTrusted returns true if the RC file is approved by a manifest
+// signed with one of the trusted keys.
+func manifestTrusted(rcPath string, trusted []ed25519.PublicKey) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+
+	manifestPath, root := findTrustManifest(filepath.Dir(rcPath))
+	if manifestPath == "" {
+		return false
+	}
+
+	manifest, err := LoadTrustManifest(manifestPath)
+	if err != nil {
+		logDebug("trust manifest: %v", err)
+		return false
+	}
+	if !manifest.Verify(trusted) {
+		logDebug("trust manifest: %s has no valid signature from a trusted key", manifestPath)
+		return false
+	}
+	if project, err := trustManifestProject(root); err != nil || project != manifest.Project {
+		logDebug("trust manifest: %s was signed for another project than %q", manifestPath, project)
+		return false
+	}
+
+	relPath, err := filepath.Rel(root, rcPath)
+	if err != nil {
+		return false
+	}
+	content, err := os.ReadFile(rcPath)
+	if err != nil {
+		return false
+	}
+	return manifest.Contains(relPath, content)
+}
+
+/// Keys
+
+const sshEd25519 = "ssh-ed25519"
+
+// ParseTrustPublicKey parses an ed25519 public key, either in the OpenSSH
+// authorized_keys format ("ssh-ed25519 AAAA... comment") or as the base64 of
+// the raw 32 bytes.
+func ParseTrustPublicKey(s string) (ed25519.PublicKey, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.New("empty public key")
+	}
+
+	if fields[0] == sshEd25519 {
+		if len(fields) < 2 {
+			return nil, errors.New("missing key data")
+		}
+		data, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		keyType, rest, err := readSSHString(data)
+		if err != nil || string(keyType) != sshEd25519 {
+			return nil, errors.New("invalid ssh-ed25519 public key")
+		}
+		key, _, err := readSSHString(rest)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ssh-ed25519 public key")
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(fields[0])
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("unsupported public key %q, only ed25519 keys are supported", s)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// FormatTrustPublicKey returns the key in the OpenSSH authorized_keys format.
+func FormatTrustPublicKey(key ed25519.PublicKey) string {
+	var buf bytes.Buffer
+	writeSSHString(&buf, []byte(sshEd25519))
+	writeSSHString(&buf, key)
+	return sshEd25519 + " " + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// LoadTrustPrivateKey reads an unencrypted ed25519 private key, either in the
+// PKCS#8 PEM format (`openssl genpkey -algorithm ed25519`) or the OpenSSH
+// format (`ssh-keygen -t ed25519 -N ""`).
+func LoadTrustPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: only ed25519 keys are supported", path)
+		}
+		return edKey, nil
+	case "OPENSSH PRIVATE KEY":
+		key, err := parseOpenSSHPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %q", path, block.Type)
+	}
+}
+
+// parseOpenSSHPrivateKey decodes the openssh-key-v1 format.
+//
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.key
+func parseOpenSSHPrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, errors.New("invalid OpenSSH private key")
+	}
+	rest := data[len(magic):]
+
+	var cipher, kdf, private []byte
+	var err error
+	if cipher, rest, err = readSSHString(rest); err != nil {
+		return nil, err
+	}
+	if kdf, rest, err = readSSHString(rest); err != nil {
+		return nil, err
+	}
+	if string(cipher) != "none" || string(kdf) != "none" {
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+	if _, rest, err = readSSHString(rest); err != nil { // kdf options
+		return nil, err
+	}
+	if len(rest) < 4 || binary.BigEndian.Uint32(rest) != 1 {
+		return nil, errors.New("only single-key files are supported")
+	}
+	rest = rest[4:]
+	if _, rest, err = readSSHString(rest); err != nil { // public key
+		return nil, err
+	}
+	if private, _, err = readSSHString(rest); err != nil {
+		return nil, err
+	}
+
+	// check1, check2
+	if len(private) < 8 || !bytes.Equal(private[0:4], private[4:8]) {
+		return nil, errors.New("invalid OpenSSH private key")
+	}
+	private = private[8:]
+
+	var keyType, key []byte
+	if keyType, private, err = readSSHString(private); err != nil {
+		return nil, err
+	}
+	if string(keyType) != sshEd25519 {
+		return nil, fmt.Errorf("only ed25519 keys are supported, got %s", keyType)
+	}
+	if _, private, err = readSSHString(private); err != nil { // public key
+		return nil, err
+	}
+	if key, _, err = readSSHString(private); err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+func readSSHString(data []byte) (value, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("truncated key data")
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(n) {
+		return nil, nil, errors.New("truncated key data")
+	}
+	return data[4 : 4+n], data[4+n:], nil
+}
+
+func writeSSHString(buf *bytes.Buffer, value []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(value)))
+	buf.Write(value)
+}
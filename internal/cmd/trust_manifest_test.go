@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrustManifest(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseTrustPublicKey(FormatTrustPublicKey(pub) + " comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(pub) {
+		t.Error("public key didn't round-trip")
+	}
+
+	manifest := &TrustManifest{Version: 1}
+	manifest.Set("svc/.envrc", []byte("export FOO=bar\n"))
+	manifest.Sign(key)
+
+	if !manifest.Verify([]ed25519.PublicKey{otherPub, pub}) {
+		t.Error("expected manifest to be verified")
+	}
+	if manifest.Verify([]ed25519.PublicKey{otherPub}) {
+		t.Error("expected manifest not to be verified by an untrusted key")
+	}
+	if !manifest.Contains("svc/.envrc", []byte("export FOO=bar\n")) {
+		t.Error("expected manifest to contain the approved content")
+	}
+	if manifest.Contains("svc/.envrc", []byte("export FOO=baz\n")) {
+		t.Error("expected manifest not to contain modified content")
+	}
+
+	manifest.Entries[0].SHA256 = "tampered"
+	if manifest.Verify([]ed25519.PublicKey{pub}) {
+		t.Error("expected tampered manifest not to be verified")
+	}
+}
+
+func TestTrustManifestRoot(t *testing.T) {
+	root, err := trustManifestRoot("/project/.direnv/trust.json")
+	if err != nil || root != "/project" {
+		t.Errorf("unexpected root %q: %v", root, err)
+	}
+	for _, manifestPath := range []string{"/project/trust.json", "/project/.direnv/other.json", "/project/sub/.direnv/trust.json/x"} {
+		if _, err := trustManifestRoot(manifestPath); err == nil {
+			t.Errorf("expected %s to be rejected", manifestPath)
+		}
+	}
+}
+
+func TestManifestTrustedProject(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("export FOO=bar\n")
+	newProject := func(origin string) string {
+		root := t.TempDir()
+		gitConfig := "[remote \"origin\"]\n\turl = " + origin + "\n"
+		if err := os.MkdirAll(filepath.Join(root, ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, ".git", "config"), []byte(gitConfig), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, ".envrc"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	manifest := &TrustManifest{Version: 1}
+	manifest.SetProject("git@github.com:myorg/repo.git")
+	manifest.Set(".envrc", content)
+	manifest.Sign(key)
+
+	// The same manifest and .envrc, in the signed project and in another one
+	for origin, expected := range map[string]bool{
+		"git@github.com:myorg/repo.git": true,
+		"git@github.com:evil/repo.git":  false,
+	} {
+		root := newProject(origin)
+		if err := manifest.Write(filepath.Join(root, TrustManifestPath)); err != nil {
+			t.Fatal(err)
+		}
+		if manifestTrusted(filepath.Join(root, ".envrc"), []ed25519.PublicKey{pub}) != expected {
+			t.Errorf("%s: expected trusted to be %v", origin, expected)
+		}
+	}
+}
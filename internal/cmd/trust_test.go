@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTrustEntries(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	dir := t.TempDir()
+
+	newRC := func(name string) *RC {
+		rcPath := filepath.Join(dir, name, ".envrc")
+		if err := os.MkdirAll(filepath.Dir(rcPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(rcPath, []byte("export NAME="+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rc, err := RCFromPath(rcPath, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rc
+	}
+
+	allowed := newRC("allowed")
+	stale := newRC("stale")
+	denied := newRC("denied")
+	for _, rc := range []*RC{allowed, stale, denied} {
+		if err := rc.Allow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(stale.Path(), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := denied.Deny(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LoadTrustEntries(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]TrustStatus{
+		allowed.Path(): TrustAllowed,
+		stale.Path():   TrustStale,
+		denied.Path():  TrustDenied,
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Status != expected[entry.Path] {
+			t.Errorf("%s: expected status %s, got %s", entry.Path, expected[entry.Path], entry.Status)
+		}
+	}
+}
+
+func TestImportTrustRebase(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	for _, dir := range []string{oldDir, newDir} {
+		if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("export FOO=bar\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldConfig := &Config{DataDir: t.TempDir()}
+	rc, err := RCFromPath(filepath.Join(oldDir, ".envrc"), oldConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	export, err := ExportTrust(oldConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newConfig := &Config{DataDir: t.TempDir()}
+	rebase := func(path string) string {
+		return filepath.Join(newDir, filepath.Base(path))
+	}
+	imported, skipped, err := ImportTrust(newConfig, export, rebase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 1 || len(skipped) != 0 {
+		t.Fatalf("expected 1 imported entry, got %d (skipped: %v)", imported, skipped)
+	}
+
+	rc, err = RCFromPath(filepath.Join(newDir, ".envrc"), newConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Allowed() != Allowed {
+		t.Error("expected the imported .envrc to be allowed")
+	}
+}
@@ -1515,6 +1515,49 @@ on_git_branch() {
   fi
 }
 
+# Usage: __direnv_record_provenance <file>
+#
+# Wraps the functions that change the environment, so that each call appends
+# a snapshot of the environment to <file> on entry and on exit.
+__direnv_record_provenance() {
+  __direnv_provenance_file=$1
+
+  # shellcheck disable=SC2317
+  __direnv_snapshot() {
+    DIRENV_PROVENANCE_EVENT=$1 DIRENV_PROVENANCE_CALL=${*:2} \
+      "$direnv" dump json 4 4>>"$__direnv_provenance_file"
+  }
+
+  # shellcheck disable=SC2317
+  __direnv_call() {
+    local fn=$1 path
+    shift
+    case $fn in
+      dotenv | dotenv_if_exists)
+        # name the file that gets loaded, which can be implicit
+        path=${1:-$PWD/.env}
+        if [[ -d $path ]]; then
+          path=$path/.env
+        fi
+        set -- "$(expand_path "$path")" "${@:2}"
+        ;;
+    esac
+    echo "$fn $*"
+  }
+
+  local fn
+  for fn in source_env dotenv dotenv_if_exists direnv_load use PATH_add path_add; do
+    eval "__direnv_orig_$(declare -f "$fn")"
+    eval "$fn() {
+      __direnv_snapshot enter \"\$(__direnv_call $fn \"\$@\")\"
+      __direnv_orig_$fn \"\$@\"
+      local ret=\$?
+      __direnv_snapshot exit
+      return \$ret
+    }"
+  done
+}
+
 # Usage: __main__ <cmd> [...<args>]
 #
 # Used by rc.go
@@ -1547,6 +1590,12 @@ __main__() {
     source "$HOME/.direnvrc" >&2
   fi
 
+  # record the variables changed by each call for `direnv why`
+  if [[ -n ${DIRENV_PROVENANCE_FILE:-} ]]; then
+    __direnv_record_provenance "$DIRENV_PROVENANCE_FILE"
+    unset DIRENV_PROVENANCE_FILE
+  fi
+
   # and finally load the .envrc
   "$@"
 }
@@ -363,3 +363,20 @@ test_start "require-allowed"
   echo "$ORIG_CONTENT" > config.toml
   direnv allow
 test_stop
+
+test_start "load-timeout"
+  echo "[global]
+load_timeout = \"1s\"" > "${XDG_CONFIG_HOME}/direnv/direnv.toml"
+  rm -f sleep.pid
+  direnv_eval
+  test -z "${LOADED:-}"
+
+  echo "The processes started by the .envrc are killed"
+  sleep 0.5
+  SLEEP_STATE=$(ps -o stat= -p "$(cat sleep.pid)" || true)
+  if [[ -n "$SLEEP_STATE" && "$SLEEP_STATE" != Z* ]]; then
+    echo "FAILED: sleep still running after load_timeout"
+    exit 1
+  fi
+  rm -f sleep.pid
+test_stop
@@ -5,4 +5,5 @@
 
 GZIP_HEADER="\x1f\x8b\x08\x00\x00\x00\x00\x00"
 
-(printf $GZIP_HEADER; echo $DIRENV_DIFF | base64 -d) | gzip -dc | python -mjson.tool
+# Strip the "v2:CRC32:" prefix of the current format
+(printf $GZIP_HEADER; echo "${DIRENV_DIFF##*:}" | base64 -d) | gzip -dc | python -mjson.tool
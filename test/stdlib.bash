@@ -242,6 +242,29 @@ test_name require_allowed_security
   [[ "${output#*'must not contain'}" != "$output" ]]
 )
 
+test_name __direnv_record_provenance
+(
+  load_stdlib
+
+  workdir=$(mktemp -d)
+  trap 'rm -rf "$workdir"' EXIT
+
+  cd "$workdir"
+  echo "FOO=bar" > .env
+  __direnv_record_provenance "$workdir/snapshots"
+
+  dotenv
+  PATH_add bin
+
+  # the implicit .env is named, and PATH_add is recorded with its path_add
+  output=$(sed -n 's/^ *"DIRENV_PROVENANCE_CALL": "\(..*\)",*$/\1/p' snapshots)
+  assert_eq "$output" "dotenv $workdir/.env
+PATH_add bin
+path_add PATH bin"
+  [[ $FOO = bar ]]
+  [[ $PATH = "$workdir/bin:"* ]]
+)
+
 # test strict_env and unstrict_env
 ./strict_env_test.bash
 
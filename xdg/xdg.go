@@ -44,3 +44,12 @@ func CacheDir(env map[string]string, programName string) string {
 	// the process' UID
 	return ""
 }
+
+// RuntimeDir returns the runtime directory for the application, or "" if
+// XDG_RUNTIME_DIR is not set as the spec gives no fallback for it
+func RuntimeDir(env map[string]string, programName string) string {
+	if env["XDG_RUNTIME_DIR"] != "" {
+		return filepath.Join(env["XDG_RUNTIME_DIR"], programName)
+	}
+	return ""
+}